@@ -13,6 +13,7 @@ const (
 	LOG_EVENT_TYPES              = (ENUM_END_EVENT - 1)
 	ST_SERVER_VER_LEN            = 50
 	CHECKSUM_VERSION_PRODUCT     = (5*256+6)*256 + 1 //从5.6.1开始，日志添加了校验
+	MYSQL_8_0_VERSION            = (8*256+0)*256 + 0 //MySQL 8.0
 	CHECKSUM_CRC32_SIGNATURE_LEN = 4
 	BINLOG_CHECKSUM_LEN          = 4
 )
@@ -57,6 +58,9 @@ const (
 	TRANSACTION_CONTEXT_EVENT                = 36
 	VIEW_CHANGE_EVENT                        = 37
 	XA_PREPARE_LOG_EVENT                     = 38 // Prepared XA transaction terminal event similar to Xid
+	PARTIAL_UPDATE_ROWS_EVENT                = 39 // MySQL 8.0 binlog_row_value_options=PARTIAL_JSON时的UPDATE, JSON列只记录修改的部分
+	TRANSACTION_PAYLOAD_EVENT                = 40 // MySQL 8.0.20 binlog_transaction_compression压缩的事务
+	HEARTBEAT_LOG_EVENT_V2                   = 41 // MySQL 8.0.26之后的心跳, 位置为64位
 	// Add new events here - right above this comment! Existing events (except ENUM_END_EVENT) should never change their numbers
 	ENUM_END_EVENT /* end marker */
 
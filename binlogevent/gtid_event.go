@@ -1,5 +1,11 @@
 package binlogevent
 
+import (
+	"fmt"
+
+	"github.com/SDHM/sqlregret/mysql"
+)
+
 const (
 	ENCODED_FLAG_LENGTH               = 1
 	ENCODED_SID_LENGTH                = 16
@@ -9,5 +15,25 @@ const (
 	POST_HEADER_LENGTH                = ENCODED_FLAG_LENGTH + ENCODED_SID_LENGTH + ENCODED_GNO_LENGTH + LOGICAL_TIMESTAMP_TYPECODE_LENGTH + LOGICAL_TIMESTAMP_LENGTH /* length of two logical timestamps */
 )
 
+const (
+	LOGICAL_TIMESTAMP_TYPECODE = 2 // 5.7之后带有last_committed与sequence_number
+)
+
 type Gtid_event struct {
+	CommitFlag     bool   // 是否为独立的事务(如DDL)
+	SID            []byte // server_uuid 16字节, 匿名事务为全0
+	GNO            int64  // 事务序号
+	LastCommitted  int64  // 组提交中依赖的上一个事务
+	SequenceNumber int64  // 组提交中的序号
+}
+
+func (this *Gtid_event) IsAnonymous() bool {
+	return this.GNO == 0
+}
+
+func (this *Gtid_event) String() string {
+	if this.IsAnonymous() {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", mysql.FormatSID(this.SID), this.GNO)
 }
@@ -0,0 +1,25 @@
+package binlogevent
+
+import "fmt"
+
+const (
+	FL_STANDALONE      = 1 // 单独的语句, 没有BEGIN/COMMIT(如DDL)
+	FL_GROUP_COMMIT_ID = 2 // 带有组提交id
+)
+
+// MariaDB的GTID格式为 domain_id-server_id-seq_no
+type Mariadb_Gtid_event struct {
+	DomainId uint32
+	ServerId uint32
+	SeqNo    uint64
+	CommitId uint64 // 组提交id, 没有时为0
+	Flags    int
+}
+
+func (this *Mariadb_Gtid_event) IsStandalone() bool {
+	return this.Flags&FL_STANDALONE != 0
+}
+
+func (this *Mariadb_Gtid_event) String() string {
+	return fmt.Sprintf("%d-%d-%d", this.DomainId, this.ServerId, this.SeqNo)
+}
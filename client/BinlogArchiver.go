@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cihub/seelog"
+)
+
+// 把master的binlog原样保存到本地, 文件名与master一致, 并维护索引文件
+// 保存下来的文件可以直接用onfile模式解析
+type BinlogArchiver struct {
+	dir       string   // 保存目录
+	indexFile string   // 索引文件名, 如 mysql-bin.index
+	file      *os.File // 当前写入的文件
+	fileName  string   // 当前写入的文件名
+	pos       int64    // 当前文件的写入位置
+}
+
+func NewBinlogArchiver(dir string) *BinlogArchiver {
+	this := new(BinlogArchiver)
+	if dir == "" {
+		dir = "."
+	}
+	this.dir = dir
+	return this
+}
+
+// 根据索引文件中最后一个文件及其大小确定继续保存的位置
+// 没有保存过时返回startFile以及文件头之后的位置4
+func (this *BinlogArchiver) ResumePosition(startFile string) (string, int64, error) {
+	if startFile == "" {
+		return "", 0, errors.New("archive模式需要指定开始文件")
+	}
+
+	files, err := this.readIndex(BinlogBaseName(startFile) + ".index")
+	if nil != err {
+		return "", 0, err
+	}
+
+	if len(files) == 0 {
+		return startFile, 4, nil
+	}
+
+	lastFile := files[len(files)-1]
+	info, err := os.Stat(filepath.Join(this.dir, lastFile))
+	if nil != err {
+		if os.IsNotExist(err) {
+			return lastFile, 4, nil
+		}
+		return "", 0, err
+	}
+
+	if info.Size() <= int64(len(binlogFileHeader)) {
+		return lastFile, 4, nil
+	}
+	return lastFile, info.Size(), nil
+}
+
+// 打开要写入的文件, pos为master上该文件接下来的事件位置
+// pos为4时新建文件, 否则在已有文件的pos处继续写入
+func (this *BinlogArchiver) Open(fileName string, pos int64) error {
+	if this.file != nil && this.fileName == fileName {
+		return nil
+	}
+	this.Close()
+
+	if err := os.MkdirAll(this.dir, 0755); nil != err {
+		return err
+	}
+
+	path := filepath.Join(this.dir, fileName)
+	if pos <= int64(len(binlogFileHeader)) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if nil != err {
+			return err
+		}
+
+		if _, err := f.Write(binlogFileHeader); nil != err {
+			f.Close()
+			return err
+		}
+		this.file = f
+		this.pos = int64(len(binlogFileHeader))
+	} else {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+		if nil != err {
+			return err
+		}
+
+		info, err := f.Stat()
+		if nil != err {
+			f.Close()
+			return err
+		}
+
+		if info.Size() < pos {
+			f.Close()
+			return fmt.Errorf("本地文件%s长度%d小于继续保存的位置%d", path, info.Size(), pos)
+		}
+
+		//丢弃断线前写入的不完整事件
+		if err := f.Truncate(pos); nil != err {
+			f.Close()
+			return err
+		}
+
+		if _, err := f.Seek(pos, 0); nil != err {
+			f.Close()
+			return err
+		}
+		this.file = f
+		this.pos = pos
+	}
+
+	this.fileName = fileName
+	seelog.Infof("开始保存binlog文件:%s\t位置:%d", path, this.pos)
+	return this.appendIndex(BinlogBaseName(fileName)+".index", fileName)
+}
+
+// 写入一个完整的事件(事件头加事件体)
+func (this *BinlogArchiver) Write(event []byte) error {
+	if this.file == nil {
+		return errors.New("没有打开的binlog文件")
+	}
+
+	if _, err := this.file.Write(event); nil != err {
+		return err
+	}
+	this.pos += int64(len(event))
+	return nil
+}
+
+func (this *BinlogArchiver) GetFileName() string {
+	return this.fileName
+}
+
+func (this *BinlogArchiver) GetPos() int64 {
+	return this.pos
+}
+
+func (this *BinlogArchiver) Close() error {
+	if this.file == nil {
+		return nil
+	}
+
+	err := this.file.Close()
+	this.file = nil
+	this.fileName = ""
+	return err
+}
+
+func (this *BinlogArchiver) readIndex(indexFile string) ([]string, error) {
+	f, err := os.Open(filepath.Join(this.dir, indexFile))
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	files := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			files = append(files, filepath.Base(line))
+		}
+	}
+	return files, scanner.Err()
+}
+
+// 索引文件与mysql一致, 每行一个 ./文件名
+func (this *BinlogArchiver) appendIndex(indexFile string, fileName string) error {
+	files, err := this.readIndex(indexFile)
+	if nil != err {
+		return err
+	}
+
+	for _, file := range files {
+		if file == fileName {
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(this.dir, indexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("./" + fileName + "\n")
+	return err
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBinlogArchiver(t *testing.T) {
+	dir := t.TempDir()
+	archiver := NewBinlogArchiver(dir)
+
+	if fileName, pos, err := archiver.ResumePosition("mysql-bin.000001"); nil != err || fileName != "mysql-bin.000001" || pos != 4 {
+		t.Fatalf("got %s %d %v", fileName, pos, err)
+	}
+
+	if err := archiver.Open("mysql-bin.000001", 4); nil != err {
+		t.Fatal(err)
+	}
+	archiver.Write([]byte("event1"))
+	if err := archiver.Open("mysql-bin.000002", 4); nil != err {
+		t.Fatal(err)
+	}
+	archiver.Write([]byte("event2"))
+	archiver.Write([]byte("partial"))
+	archiver.Close()
+
+	index, _ := os.ReadFile(filepath.Join(dir, "mysql-bin.index"))
+	if string(index) != "./mysql-bin.000001\n./mysql-bin.000002\n" {
+		t.Fatalf("got index %q", index)
+	}
+
+	fileName, pos, err := archiver.ResumePosition("mysql-bin.000001")
+	if nil != err || fileName != "mysql-bin.000002" || pos != int64(4+len("event2partial")) {
+		t.Fatalf("got %s %d %v", fileName, pos, err)
+	}
+
+	// 断线重连时从最后一个完整事件之后继续, 丢弃之后写入的数据
+	if err := archiver.Open("mysql-bin.000002", int64(4+len("event2"))); nil != err {
+		t.Fatal(err)
+	}
+	archiver.Write([]byte("event3"))
+	archiver.Close()
+
+	data, _ := os.ReadFile(filepath.Join(dir, "mysql-bin.000002"))
+	if !bytes.Equal(data, append(append([]byte{}, binlogFileHeader...), "event2event3"...)) {
+		t.Fatalf("got %q", data)
+	}
+
+	if err := archiver.Open("mysql-bin.000002", 100); nil == err {
+		t.Fatal("position beyond local file should fail")
+	}
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 归档的binlog文件可能被压缩
+const (
+	GZIP_SUFFIX = ".gz"
+	ZSTD_SUFFIX = ".zst"
+)
+
+var (
+	gzipMagic []byte = []byte{0x1f, 0x8b}
+	zstdMagic []byte = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// 去掉压缩文件的后缀, mysql-bin.000123.gz => mysql-bin.000123
+func TrimCompressSuffix(fileName string) string {
+	for _, suffix := range []string{GZIP_SUFFIX, ZSTD_SUFFIX} {
+		if strings.HasSuffix(fileName, suffix) {
+			return strings.TrimSuffix(fileName, suffix)
+		}
+	}
+	return fileName
+}
+
+// binlog文件的序号, 即最后一个"."之后的数字, 前缀中可以带有"."
+// 如 mysql-bin.000123、db.prod-bin.000123.gz
+func BinlogFileIndex(fileName string) (int, error) {
+	fileName = TrimCompressSuffix(filepath.Base(fileName))
+	sep := strings.LastIndex(fileName, ".")
+	if sep == -1 {
+		return 0, fmt.Errorf("无法识别binlog文件序号:%s", fileName)
+	}
+
+	index, err := strconv.Atoi(fileName[sep+1:])
+	if nil != err {
+		return 0, fmt.Errorf("无法识别binlog文件序号:%s", fileName)
+	}
+	return index, nil
+}
+
+// binlog文件的前缀, mysql-bin.000123 => mysql-bin
+func BinlogBaseName(fileName string) string {
+	fileName = TrimCompressSuffix(filepath.Base(fileName))
+	if sep := strings.LastIndex(fileName, "."); sep != -1 {
+		return fileName[:sep]
+	}
+	return fileName
+}
+
+// 按序号排序binlog文件
+func sortBinlogFiles(files []string) error {
+	indexs := make(map[string]int, len(files))
+	for _, file := range files {
+		index, err := BinlogFileIndex(file)
+		if nil != err {
+			return err
+		}
+		indexs[file] = index
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return indexs[files[i]] < indexs[files[j]]
+	})
+	return nil
+}
+
+// 扫描目录下的binlog文件, 按序号排序
+// 目录下有多个前缀时, 只取与startFile相同前缀的文件
+func scanBinlogFiles(dir string, startFile string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if nil != err {
+		return nil, err
+	}
+
+	//同一个文件同时有压缩与未压缩的版本时(如正在压缩或gzip -k)只取未压缩的, 否则会解析两遍
+	fileNames := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if _, err := BinlogFileIndex(entry.Name()); nil != err {
+			continue
+		}
+
+		fileName := TrimCompressSuffix(entry.Name())
+		if other, ok := fileNames[fileName]; !ok || (other != fileName && entry.Name() == fileName) {
+			fileNames[fileName] = entry.Name()
+		}
+	}
+
+	groups := make(map[string][]string)
+	for _, name := range fileNames {
+		baseName := BinlogBaseName(name)
+		groups[baseName] = append(groups[baseName], filepath.Join(dir, name))
+	}
+
+	var files []string
+	if startFile != "" {
+		files = groups[BinlogBaseName(startFile)]
+	} else if len(groups) == 1 {
+		for _, group := range groups {
+			files = group
+		}
+	} else if len(groups) > 1 {
+		names := make([]string, 0, len(groups))
+		for baseName := range groups {
+			names = append(names, baseName)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("目录%s下有多种binlog文件前缀(%s), 请指定开始文件", dir, strings.Join(names, ","))
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("目录%s下没有找到binlog文件", dir)
+	}
+
+	if err := sortBinlogFiles(files); nil != err {
+		return nil, err
+	}
+	return files, nil
+}
+
+// 打开binlog文件, 文件不存在时依次尝试压缩后的文件
+// 压缩文件按后缀或文件头识别, 返回解压后的数据流
+func openBinlogFile(fileName string) (io.Reader, io.Closer, error) {
+	f, err := os.Open(fileName)
+	if nil != err && os.IsNotExist(err) && TrimCompressSuffix(fileName) == fileName {
+		for _, suffix := range []string{GZIP_SUFFIX, ZSTD_SUFFIX} {
+			if cf, cerr := os.Open(fileName + suffix); nil == cerr {
+				f, err = cf, nil
+				fileName += suffix
+				break
+			}
+		}
+	}
+	if nil != err {
+		return nil, nil, err
+	}
+
+	reader, closeFunc, err := decompressBinlog(f, fileName)
+	if nil != err {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if nil == closeFunc {
+		return reader, f, nil
+	}
+	return reader, &binlogFileCloser{f, closeFunc}, nil
+}
+
+// 按后缀或文件头识别压缩格式, 返回解压后的数据流以及关闭解压器的函数, 没有压缩时函数为空
+func decompressBinlog(r io.Reader, fileName string) (io.Reader, func() error, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case strings.HasSuffix(fileName, GZIP_SUFFIX) || bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if nil != err {
+			return nil, nil, err
+		}
+		return gr, gr.Close, nil
+	case strings.HasSuffix(fileName, ZSTD_SUFFIX) || bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if nil != err {
+			return nil, nil, err
+		}
+		return zr, func() error { zr.Close(); return nil }, nil
+	default:
+		return br, nil, nil
+	}
+}
+
+// 同时关闭解压器与文件
+type binlogFileCloser struct {
+	file      *os.File
+	closeFunc func() error
+}
+
+func (this *binlogFileCloser) Close() error {
+	this.closeFunc()
+	return this.file.Close()
+}
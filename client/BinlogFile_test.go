@@ -0,0 +1,95 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestOpenCompressedBinlogFile(t *testing.T) {
+	dir := t.TempDir()
+	content := append(append([]byte{}, binlogFileHeader...), []byte("binlog events")...)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(content)
+	gw.Close()
+
+	zw, _ := zstd.NewWriter(nil)
+	zst := zw.EncodeAll(content, nil)
+	zw.Close()
+
+	files := map[string][]byte{
+		"mysql-bin.000001":     content,
+		"mysql-bin.000002.gz":  gz.Bytes(),
+		"mysql-bin.000003.zst": zst,
+		"mysql-bin.000004":     gz.Bytes(), // 没有后缀, 按文件头识别
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	// 000002、000003 按文件名找不到时自动尝试压缩后缀
+	for _, name := range []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003.zst", "mysql-bin.000004"} {
+		reader, closer, err := openBinlogFile(filepath.Join(dir, name))
+		if nil != err {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		data, err := io.ReadAll(reader)
+		closer.Close()
+		if nil != err {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Fatalf("%s: got %q", name, data)
+		}
+	}
+
+	if TrimCompressSuffix("mysql-bin.000002.gz") != "mysql-bin.000002" {
+		t.Fatal("trim suffix failed")
+	}
+}
+
+func TestScanBinlogFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"db.prod-bin.000010", "db.prod-bin.000009.gz", "db.prod-bin.000100", "db.prod-bin.000010.gz",
+		"db.prod-bin.index", "relay-bin.000001", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), binlogFileHeader, 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	if index, err := BinlogFileIndex("db.prod-bin.000009.gz"); nil != err || index != 9 {
+		t.Fatalf("got %d %v", index, err)
+	}
+	if _, err := BinlogFileIndex("db.prod-bin.index"); nil == err {
+		t.Fatal("index file has no sequence number")
+	}
+
+	if _, err := scanBinlogFiles(dir, ""); nil == err {
+		t.Fatal("multiple basenames should need a start file")
+	}
+
+	files, err := scanBinlogFiles(dir, "db.prod-bin.000010")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	expect := []string{"db.prod-bin.000009.gz", "db.prod-bin.000010", "db.prod-bin.000100"}
+	if len(files) != len(expect) {
+		t.Fatalf("got %v", files)
+	}
+	for i := range expect {
+		if filepath.Base(files[i]) != expect[i] {
+			t.Fatalf("got %v", files)
+		}
+	}
+}
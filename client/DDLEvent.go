@@ -0,0 +1,233 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/SDHM/sqlregret/protocol"
+)
+
+// DDL涉及的表, 库级别的DDL(如DROP DATABASE)表名为空
+type DDLTable struct {
+	DbName  string
+	TblName string
+}
+
+func (this *DDLTable) String() string {
+	if this.TblName == "" {
+		return this.DbName
+	}
+	return this.DbName + "." + this.TblName
+}
+
+// 按类型分类的DDL语句
+type DDLEvent struct {
+	EventType protocol.EventType // CREATE、ALTER、ERASE、TRUNCATE、RENAME、CINDEX、DINDEX, 其他语句为QUERY
+	Schema    string             // 执行语句时的默认库
+	Tables    []*DDLTable        // 涉及的表
+	RenameTo  []*DDLTable        // RENAME时与Tables一一对应的新表名
+	Temporary bool               // 临时表的CREATE/DROP, 不影响真实的表, 类型为QUERY
+	Sql       string
+}
+
+// 对QUERY_EVENT中的语句分类, schema为语句执行时的默认库
+func ParseDDLEvent(schema string, sql string) *DDLEvent {
+	this := new(DDLEvent)
+	this.EventType = protocol.EventType_QUERY
+	this.Schema = schema
+	this.Sql = sql
+
+	parser := newDDLParser(sql, schema)
+	switch {
+	case parser.accept("create"):
+		this.Temporary = parser.accept("temporary")
+		switch {
+		case parser.accept("table"):
+			this.EventType = protocol.EventType_CREATE
+			if parser.accept("if") {
+				parser.accept("not")
+				parser.accept("exists")
+			}
+			this.addTable(parser)
+		case parser.accept("database", "schema"):
+			this.EventType = protocol.EventType_CREATE
+			if parser.accept("if") {
+				parser.accept("not")
+				parser.accept("exists")
+			}
+			this.Tables = append(this.Tables, &DDLTable{DbName: parser.next().text})
+		default:
+			parser.accept("online", "offline")
+			parser.accept("unique", "fulltext", "spatial")
+			if parser.accept("index") {
+				this.EventType = protocol.EventType_CINDEX
+				this.addIndexTable(parser)
+			}
+		}
+	case parser.accept("alter"):
+		parser.accept("online", "offline")
+		parser.accept("ignore")
+		if parser.accept("table") {
+			this.EventType = protocol.EventType_ALTER
+			this.addTable(parser)
+			this.classifyAlter(parser)
+		} else if parser.accept("database", "schema") {
+			this.EventType = protocol.EventType_ALTER
+			this.Tables = append(this.Tables, &DDLTable{DbName: parser.next().text})
+		}
+	case parser.accept("drop"):
+		this.Temporary = parser.accept("temporary")
+		switch {
+		case parser.accept("table", "tables"):
+			this.EventType = protocol.EventType_ERASE
+			if parser.accept("if") {
+				parser.accept("exists")
+			}
+			for !parser.eof() && !parser.isKeyword("restrict", "cascade") {
+				this.addTable(parser)
+				parser.acceptPunct(",")
+			}
+		case parser.accept("database", "schema"):
+			this.EventType = protocol.EventType_ERASE
+			if parser.accept("if") {
+				parser.accept("exists")
+			}
+			this.Tables = append(this.Tables, &DDLTable{DbName: parser.next().text})
+		default:
+			parser.accept("online", "offline")
+			if parser.accept("index") {
+				this.EventType = protocol.EventType_DINDEX
+				this.addIndexTable(parser)
+			}
+		}
+	case parser.accept("truncate"):
+		this.EventType = protocol.EventType_TRUNCATE
+		parser.accept("table")
+		this.addTable(parser)
+	case parser.accept("rename"):
+		if parser.accept("table", "tables") {
+			this.EventType = protocol.EventType_RENAME
+			for !parser.eof() {
+				this.addTable(parser)
+				if !parser.accept("to") {
+					break
+				}
+				this.addRenameTo(parser)
+				parser.acceptPunct(",")
+			}
+		}
+	}
+
+	//会话结束时服务端会写入 DROP /*!40005 TEMPORARY */ TABLE, 不是删除真实的表
+	if this.Temporary {
+		this.EventType = protocol.EventType_QUERY
+	}
+	return this
+}
+
+// 输出的类型名称, 临时表单独标出
+func (this *DDLEvent) TypeName() string {
+	if this.Temporary {
+		return this.EventType.String() + "(临时表)"
+	}
+	return this.EventType.String()
+}
+
+func (this *DDLEvent) addTable(parser *ddlParser) {
+	this.Tables = append(this.Tables, newDDLTable(parser.tableName()))
+}
+
+func (this *DDLEvent) addRenameTo(parser *ddlParser) {
+	this.RenameTo = append(this.RenameTo, newDDLTable(parser.tableName()))
+}
+
+// CREATE INDEX name ON table / DROP INDEX name ON table
+func (this *DDLEvent) addIndexTable(parser *ddlParser) {
+	parser.next()
+	for !parser.eof() && !parser.accept("on") {
+		parser.next()
+	}
+	if !parser.eof() {
+		this.addTable(parser)
+	}
+}
+
+// 只有RENAME子句的ALTER TABLE为RENAME, 只增加或只删除索引的为CINDEX或DINDEX, 其他为ALTER
+func (this *DDLEvent) classifyAlter(parser *ddlParser) {
+	eventType := protocol.EventType(0)
+	for !parser.eof() {
+		clauseType := protocol.EventType_ALTER
+		switch {
+		case parser.accept("rename"):
+			if !parser.isKeyword("column", "index", "key") {
+				if !parser.accept("to") {
+					parser.accept("as")
+				}
+				clauseType = protocol.EventType_RENAME
+				this.addRenameTo(parser)
+			}
+		case parser.accept("add"):
+			if parser.isKeyword("index", "key", "unique", "fulltext", "spatial") {
+				clauseType = protocol.EventType_CINDEX
+			}
+		case parser.accept("drop"):
+			if parser.isKeyword("index", "key") {
+				clauseType = protocol.EventType_DINDEX
+			}
+		}
+
+		if eventType == 0 {
+			eventType = clauseType
+		} else if eventType != clauseType {
+			eventType = protocol.EventType_ALTER
+		}
+
+		parser.skipItem()
+		if !parser.acceptPunct(",") && !parser.eof() {
+			parser.next()
+		}
+	}
+
+	//RENAME与其他子句一起时为ALTER, 仍然记录新表名
+	if eventType != 0 {
+		this.EventType = eventType
+	}
+}
+
+func newDDLTable(fullName string) *DDLTable {
+	names := strings.SplitN(fullName, ".", 2)
+	return &DDLTable{DbName: names[0], TblName: names[1]}
+}
+
+// 是否满足库表过滤条件, 涉及多个表时任意一个满足即可
+func (this *DDLEvent) MatchTable(dbName string, tableName string) bool {
+	if dbName == "" {
+		return true
+	}
+
+	for _, tables := range [][]*DDLTable{this.Tables, this.RenameTo} {
+		for _, table := range tables {
+			if !strings.EqualFold(table.DbName, dbName) {
+				continue
+			}
+			if tableName == "" || strings.EqualFold(table.TblName, tableName) {
+				return true
+			}
+		}
+	}
+
+	//没有表名的语句(如GRANT)按默认库过滤
+	return len(this.Tables) == 0 && tableName == "" && strings.EqualFold(this.Schema, dbName)
+}
+
+// 表名, RENAME时为 原表名->新表名
+func (this *DDLEvent) TableNames() string {
+	names := make([]string, 0, len(this.Tables))
+	for i, table := range this.Tables {
+		if i < len(this.RenameTo) {
+			names = append(names, table.String()+"->"+this.RenameTo[i].String())
+		} else {
+			names = append(names, table.String())
+		}
+	}
+	return strings.Join(names, ",")
+}
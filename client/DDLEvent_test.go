@@ -0,0 +1,77 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/config"
+	"github.com/SDHM/sqlregret/mysql"
+	"github.com/SDHM/sqlregret/protocol"
+)
+
+func TestParseDDLEvent(t *testing.T) {
+	cases := []struct {
+		sql       string
+		eventType protocol.EventType
+		tables    string
+	}{
+		{"CREATE TABLE IF NOT EXISTS `t1` (id int)", protocol.EventType_CREATE, "test.t1"},
+		{"alter table other.t1 add column c int, drop index idx", protocol.EventType_ALTER, "other.t1"},
+		{"ALTER TABLE t1 ADD INDEX idx(c), ADD UNIQUE KEY uk(d)", protocol.EventType_CINDEX, "test.t1"},
+		{"alter table t1 drop key idx", protocol.EventType_DINDEX, "test.t1"},
+		{"alter table t1 rename to t2", protocol.EventType_RENAME, "test.t1->test.t2"},
+		{"DROP TABLE `t1`,`other`.`t2` /* generated by server */", protocol.EventType_ERASE, "test.t1,other.t2"},
+		{"drop database if exists other", protocol.EventType_ERASE, "other"},
+		{"truncate table t1", protocol.EventType_TRUNCATE, "test.t1"},
+		{"TRUNCATE t1", protocol.EventType_TRUNCATE, "test.t1"},
+		{"rename table t1 to t1_bak, t2 to other.t1", protocol.EventType_RENAME, "test.t1->test.t1_bak,test.t2->other.t1"},
+		{"create unique index uk on t1 (c)", protocol.EventType_CINDEX, "test.t1"},
+		{"drop index idx on other.t1", protocol.EventType_DINDEX, "other.t1"},
+		{"grant select on *.* to 'u'@'%'", protocol.EventType_QUERY, ""},
+		{"DROP /*!40005 TEMPORARY */ TABLE IF EXISTS `t1`", protocol.EventType_QUERY, "test.t1"},
+		{"create temporary table t1 (id int)", protocol.EventType_QUERY, "test.t1"},
+		{"/*!40101 DROP */ TABLE t1", protocol.EventType_ERASE, "test.t1"},
+	}
+
+	for _, c := range cases {
+		ddlEvent := ParseDDLEvent("test", c.sql)
+		if ddlEvent.EventType != c.eventType || ddlEvent.TableNames() != c.tables {
+			t.Errorf("%s: got %s %q, expect %s %q", c.sql, ddlEvent.EventType, ddlEvent.TableNames(), c.eventType, c.tables)
+		}
+	}
+
+	if typeName := ParseDDLEvent("test", "drop temporary table t1").TypeName(); typeName != "QUERY(临时表)" {
+		t.Errorf("got type %s", typeName)
+	}
+
+	ddlEvent := ParseDDLEvent("test", "rename table t1 to t1_bak, t2 to other.t1")
+	if !ddlEvent.MatchTable("other", "t1") || !ddlEvent.MatchTable("test", "") || ddlEvent.MatchTable("test", "t3") {
+		t.Error("rename should match both source and target tables")
+	}
+}
+
+func TestReadDDLEventGtid(t *testing.T) {
+	withDDL, gtidSet := config.G_filterConfig.WithDDL, config.G_filterConfig.GtidSet
+	defer func() {
+		config.G_filterConfig.WithDDL, config.G_filterConfig.GtidSet = withDDL, gtidSet
+	}()
+	config.G_filterConfig.WithDDL = true
+	config.G_filterConfig.GtidSet, _ = mysql.ParseGtidSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:2")
+	sid, _ := mysql.ParseSID("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+
+	var output bytes.Buffer
+	G_transaction = NewBufferTransaction(&output, &output)
+	parser := &LogParser{context: NewLogContext()}
+	for gno, sql := range map[int64]string{2: "drop table t2", 3: "drop table t3"} {
+		event := newTestQueryEvent("test", sql)
+		header := parser.ReadEventHeader(mysql.NewLogBuffer(newTestEvent(event[0], 4, event[1:])))
+		G_transaction.SetGtid(&binlogevent.Gtid_event{SID: sid, GNO: gno})
+		parser.ReadDDLEvent(header, ParseQueryLogEvent(mysql.NewLogBuffer(event[1:]), parser.context.GetFormatDescription()))
+	}
+
+	if !strings.Contains(output.String(), "drop table t2") || strings.Contains(output.String(), "drop table t3") {
+		t.Fatalf("got %q", output.String())
+	}
+}
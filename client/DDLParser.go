@@ -0,0 +1,655 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/SDHM/sqlregret/mysql"
+)
+
+const (
+	DDL_TOKEN_WORD   = iota // 关键字或标识符
+	DDL_TOKEN_QUOTED        // `标识符`
+	DDL_TOKEN_STRING        // '字符串'
+	DDL_TOKEN_PUNCT         // 标点
+)
+
+type ddlToken struct {
+	kind int
+	text string
+}
+
+// 把DDL语句切分为单词、标识符、字符串、标点, 忽略注释
+// /*!NNNNN ... */ 是MySQL的版本注释, 服务端会执行其中的内容, 如 DROP /*!40005 TEMPORARY */ TABLE
+func tokenizeDDL(sql string) []*ddlToken {
+	tokens := make([]*ddlToken, 0, 32)
+	versioned := false
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(sql[i:], "/*!"):
+			i += 3
+			for i < len(sql) && sql[i] >= '0' && sql[i] <= '9' {
+				i++
+			}
+			versioned = true
+		case versioned && strings.HasPrefix(sql[i:], "*/"):
+			i += 2
+			versioned = false
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+		case strings.HasPrefix(sql[i:], "-- ") || c == '#':
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '`' || c == '\'' || c == '"':
+			text, n := readQuoted(sql[i:], c)
+			kind := DDL_TOKEN_STRING
+			if c == '`' {
+				kind = DDL_TOKEN_QUOTED
+			}
+			tokens = append(tokens, &ddlToken{kind: kind, text: text})
+			i += n
+		case isWordChar(c):
+			start := i
+			for i < len(sql) && isWordChar(sql[i]) {
+				i++
+			}
+			tokens = append(tokens, &ddlToken{kind: DDL_TOKEN_WORD, text: sql[start:i]})
+		default:
+			tokens = append(tokens, &ddlToken{kind: DDL_TOKEN_PUNCT, text: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// 读取引号中的内容, 引号重复或反斜杠表示转义, 返回内容与消耗的长度
+func readQuoted(sql string, quote byte) (string, int) {
+	var text strings.Builder
+	for i := 1; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\\' && quote != '`' && i+1 < len(sql):
+			i++
+			text.WriteByte(sql[i])
+		case c == quote && i+1 < len(sql) && sql[i+1] == quote:
+			i++
+			text.WriteByte(quote)
+		case c == quote:
+			return text.String(), i + 1
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return text.String(), len(sql)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// 简单的DDL解析器, 只关心表结构的变化
+type ddlParser struct {
+	tokens     []*ddlToken
+	pos        int
+	schema     string                                 // 默认库
+	get        func(fullName string) *TableMeta       // 当前的表结构
+	set        func(fullName string, meta *TableMeta) // 修改表结构, meta为空表示删除
+	dropSchema func(schema string)                    // 删除库
+}
+
+func newDDLParser(sql string, schema string) *ddlParser {
+	this := new(ddlParser)
+	this.tokens = tokenizeDDL(sql)
+	this.schema = schema
+	return this
+}
+
+func (this *ddlParser) peek() *ddlToken {
+	if this.pos < len(this.tokens) {
+		return this.tokens[this.pos]
+	}
+	return &ddlToken{kind: DDL_TOKEN_PUNCT}
+}
+
+func (this *ddlParser) next() *ddlToken {
+	token := this.peek()
+	if this.pos < len(this.tokens) {
+		this.pos++
+	}
+	return token
+}
+
+func (this *ddlParser) eof() bool {
+	return this.pos >= len(this.tokens)
+}
+
+// 下一个是否为指定的关键字之一, 带反引号的是标识符, 不是关键字
+func (this *ddlParser) isKeyword(words ...string) bool {
+	token := this.peek()
+	if token.kind != DDL_TOKEN_WORD {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(token.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ddlParser) accept(words ...string) bool {
+	if this.isKeyword(words...) {
+		this.pos++
+		return true
+	}
+	return false
+}
+
+func (this *ddlParser) isPunct(punct string) bool {
+	token := this.peek()
+	return token.kind == DDL_TOKEN_PUNCT && token.text == punct
+}
+
+func (this *ddlParser) acceptPunct(punct string) bool {
+	if this.isPunct(punct) {
+		this.pos++
+		return true
+	}
+	return false
+}
+
+// 跳过括号及其中的内容, 当前必须是左括号
+func (this *ddlParser) skipParens() {
+	depth := 0
+	for !this.eof() {
+		token := this.next()
+		if token.kind != DDL_TOKEN_PUNCT {
+			continue
+		}
+		if token.text == "(" {
+			depth++
+		} else if token.text == ")" {
+			depth--
+			if depth <= 0 {
+				return
+			}
+		}
+	}
+}
+
+// 跳到同一层的逗号或右括号
+func (this *ddlParser) skipItem() {
+	for !this.eof() && !this.isPunct(",") && !this.isPunct(")") {
+		if this.isPunct("(") {
+			this.skipParens()
+		} else {
+			this.next()
+		}
+	}
+}
+
+// 库名.表名, 没有库名时使用默认库
+func (this *ddlParser) tableName() string {
+	name := this.next().text
+	if this.acceptPunct(".") {
+		return name + "." + this.next().text
+	}
+	return this.schema + "." + name
+}
+
+func (this *ddlParser) parse() {
+	switch {
+	case this.accept("create"):
+		//临时表只在会话中存在, 不影响同名表的表结构
+		if this.accept("temporary") {
+			return
+		}
+		if this.accept("table") {
+			this.parseCreate()
+		}
+	case this.accept("alter"):
+		this.accept("online", "offline")
+		this.accept("ignore")
+		if this.accept("table") {
+			this.parseAlter()
+		}
+	case this.accept("drop"):
+		if this.accept("temporary") {
+			return
+		}
+		if this.accept("table", "tables") {
+			this.parseDrop()
+		} else if this.accept("database", "schema") {
+			this.accept("if")
+			this.accept("exists")
+			this.dropSchema(this.next().text)
+		}
+	case this.accept("rename"):
+		if this.accept("table", "tables") {
+			this.parseRename()
+		}
+	}
+}
+
+// CREATE TABLE [IF NOT EXISTS] name (定义) | LIKE other
+func (this *ddlParser) parseCreate() {
+	ifNotExists := false
+	if this.accept("if") {
+		this.accept("not")
+		this.accept("exists")
+		ifNotExists = true
+	}
+
+	fullName := this.tableName()
+	if ifNotExists && nil != this.get(fullName) {
+		return
+	}
+
+	paren := this.acceptPunct("(")
+	if this.accept("like") {
+		if other := this.get(this.tableName()); nil != other {
+			this.set(fullName, NewTableMeta(fullName, copyFields(other.Fileds)))
+		}
+		return
+	}
+
+	//CREATE TABLE ... SELECT 没有列定义时无法得知表结构
+	if !paren {
+		return
+	}
+
+	fields := make([]*FieldMeta, 0, 10)
+	for !this.eof() && !this.acceptPunct(")") {
+		switch {
+		case this.accept("constraint"):
+			if !this.isKeyword("primary", "unique", "foreign", "check") {
+				this.next()
+			}
+			if this.accept("primary") {
+				this.parsePrimaryKey(fields)
+			}
+		case this.accept("primary"):
+			this.parsePrimaryKey(fields)
+		case this.isKeyword("key", "index", "unique", "fulltext", "spatial", "foreign", "check"):
+		default:
+			fields = append(fields, this.parseColumn())
+		}
+		this.skipItem()
+		this.acceptPunct(",")
+	}
+
+	setCollation(fields, this.parseTableCollation(), false)
+	this.set(fullName, NewTableMeta(fullName, fields))
+}
+
+// PRIMARY KEY [name] (列, ...), 当前在KEY之前
+func (this *ddlParser) parsePrimaryKey(fields []*FieldMeta) {
+	this.accept("key")
+	for !this.eof() && !this.isPunct("(") {
+		this.next()
+	}
+	if !this.acceptPunct("(") {
+		return
+	}
+
+	for !this.eof() && !this.acceptPunct(")") {
+		if index := findField(fields, this.next().text); index >= 0 {
+			fields[index].IsKey = "PRI"
+			fields[index].IsNullable = "NO"
+		}
+		//前缀长度以及排序
+		this.skipItem()
+		this.acceptPunct(",")
+	}
+}
+
+// 列定义: 列名 类型[(参数)] [UNSIGNED] [NOT NULL] [DEFAULT 值] [AUTO_INCREMENT] [PRIMARY KEY] ...
+func (this *ddlParser) parseColumn() *FieldMeta {
+	field := new(FieldMeta)
+	field.ColumnName = this.next().text
+	field.ColumnType = strings.ToLower(this.next().text)
+	field.IsNullable = "YES"
+
+	if this.isPunct("(") {
+		this.next()
+		args := make([]string, 0, 2)
+		for !this.eof() && !this.acceptPunct(")") {
+			if token := this.next(); token.kind == DDL_TOKEN_STRING {
+				args = append(args, "'"+strings.Replace(token.text, "'", "''", -1)+"'")
+			} else if token.text != "," {
+				args = append(args, token.text)
+			}
+		}
+		field.ColumnType += "(" + strings.Join(args, ",") + ")"
+	}
+
+	for !this.eof() && !this.isPunct(",") && !this.isPunct(")") && !this.isKeyword("first", "after") {
+		switch {
+		case this.isKeyword("unsigned", "zerofill"):
+			field.ColumnType += " " + strings.ToLower(this.next().text)
+		case this.accept("not"):
+			if this.accept("null") {
+				field.IsNullable = "NO"
+			}
+		case this.accept("null"):
+			field.IsNullable = "YES"
+		case this.accept("default"):
+			field.DefaultValue = this.parseDefault()
+		case this.accept("auto_increment"):
+			field.Extra = "auto_increment"
+		case this.accept("primary"), this.accept("key"):
+			field.IsKey = "PRI"
+			field.IsNullable = "NO"
+		case this.accept("unique"):
+			//UNIQUE [KEY]中的KEY不是主键
+			this.accept("key")
+			if field.IsKey == "" {
+				field.IsKey = "UNI"
+			}
+		case this.accept("character"):
+			this.accept("set")
+			field.Collation = this.parseCharset()
+		case this.accept("charset"):
+			field.Collation = this.parseCharset()
+		case this.accept("collate"):
+			this.acceptPunct("=")
+			field.Collation = strings.ToLower(this.next().text)
+		case this.isPunct("("):
+			this.skipParens()
+		default:
+			this.next()
+		}
+	}
+	return field
+}
+
+// 字符集名称, 返回该字符集默认的排序规则
+func (this *ddlParser) parseCharset() string {
+	this.acceptPunct("=")
+	charset := strings.ToLower(this.next().text)
+	if collation, ok := mysql.Charsets[charset]; ok {
+		return collation
+	}
+	return charset
+}
+
+// 表选项中的默认字符集: [DEFAULT] CHARACTER SET|CHARSET [=] name [COLLATE [=] name]
+func (this *ddlParser) parseTableCollation() string {
+	collation := ""
+	for !this.eof() {
+		switch {
+		case this.accept("character"):
+			this.accept("set")
+			if collation == "" {
+				collation = this.parseCharset()
+			}
+		case this.accept("charset"):
+			if collation == "" {
+				collation = this.parseCharset()
+			}
+		case this.accept("collate"):
+			this.acceptPunct("=")
+			collation = strings.ToLower(this.next().text)
+		default:
+			this.next()
+		}
+	}
+	return collation
+}
+
+// 没有指定字符集的字符列使用表的默认字符集, force为true时(CONVERT TO)所有字符列都修改
+func setCollation(fields []*FieldMeta, collation string, force bool) {
+	if collation == "" {
+		return
+	}
+	for _, field := range fields {
+		if (force || field.Collation == "") && isCharacterType(field.ColumnType) {
+			field.Collation = collation
+		}
+	}
+}
+
+func isCharacterType(columnType string) bool {
+	for _, prefix := range []string{"char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set"} {
+		if columnType == prefix || strings.HasPrefix(columnType, prefix+"(") || strings.HasPrefix(columnType, prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ddlParser) parseDefault() string {
+	if this.isPunct("(") {
+		this.skipParens()
+		return ""
+	}
+
+	token := this.next()
+	if token.kind == DDL_TOKEN_PUNCT && (token.text == "-" || token.text == "+") {
+		return token.text + this.next().text
+	}
+	if this.isPunct("(") {
+		//CURRENT_TIMESTAMP(6)之类的函数
+		this.skipParens()
+	}
+	if token.kind == DDL_TOKEN_WORD && strings.EqualFold(token.text, "null") {
+		return ""
+	}
+	return token.text
+}
+
+// ALTER TABLE name 子句[, 子句...]
+func (this *ddlParser) parseAlter() {
+	fullName := this.tableName()
+	current := this.get(fullName)
+	if nil == current {
+		return
+	}
+
+	newName := fullName
+	fields := copyFields(current.Fileds)
+	for !this.eof() {
+		switch {
+		case this.accept("add"):
+			fields = this.parseAdd(fields)
+		case this.accept("drop"):
+			fields = this.parseDropColumn(fields)
+		case this.accept("modify"):
+			this.accept("column")
+			fields = this.parseChange(fields, this.peek().text)
+		case this.accept("change"):
+			this.accept("column")
+			fields = this.parseChange(fields, this.next().text)
+		case this.accept("rename"):
+			if this.accept("column") {
+				if index := findField(fields, this.next().text); index >= 0 && this.accept("to") {
+					fields[index].ColumnName = this.next().text
+				}
+			} else if !this.isKeyword("index", "key") {
+				if !this.accept("to") {
+					this.accept("as")
+				}
+				newName = this.tableName()
+			}
+		case this.accept("convert"):
+			//CONVERT TO CHARACTER SET name [COLLATE name]
+			if this.accept("to") {
+				collation := ""
+				if this.accept("character") {
+					this.accept("set")
+					collation = this.parseCharset()
+				} else if this.accept("charset") {
+					collation = this.parseCharset()
+				}
+				if this.accept("collate") {
+					this.acceptPunct("=")
+					collation = strings.ToLower(this.next().text)
+				}
+				setCollation(fields, collation, true)
+			}
+		case this.accept("alter"):
+			this.accept("column")
+			if index := findField(fields, this.next().text); index >= 0 {
+				if this.accept("set") && this.accept("default") {
+					fields[index].DefaultValue = this.parseDefault()
+				} else if this.accept("drop") && this.accept("default") {
+					fields[index].DefaultValue = ""
+				}
+			}
+		}
+		this.skipItem()
+		if !this.acceptPunct(",") && !this.eof() {
+			//分区等其他子句
+			this.next()
+		}
+	}
+
+	if newName != fullName {
+		this.set(fullName, nil)
+	}
+	this.set(newName, NewTableMeta(newName, fields))
+}
+
+// ADD [COLUMN] 列定义 [FIRST | AFTER 列] | ADD [COLUMN] (列定义, ...) | ADD PRIMARY KEY (...)
+func (this *ddlParser) parseAdd(fields []*FieldMeta) []*FieldMeta {
+	if this.accept("constraint") && !this.isKeyword("primary", "unique", "foreign", "check") {
+		this.next()
+	}
+	if this.accept("primary") {
+		this.parsePrimaryKey(fields)
+		return fields
+	}
+	if this.isKeyword("key", "index", "unique", "fulltext", "spatial", "foreign", "check", "partition") {
+		return fields
+	}
+
+	this.accept("column")
+	if this.acceptPunct("(") {
+		for !this.eof() && !this.acceptPunct(")") {
+			fields = append(fields, this.parseColumn())
+			this.skipItem()
+			this.acceptPunct(",")
+		}
+		return fields
+	}
+
+	return this.insertField(fields, this.parseColumn())
+}
+
+// DROP [COLUMN] 列 | DROP PRIMARY KEY | DROP INDEX ...
+func (this *ddlParser) parseDropColumn(fields []*FieldMeta) []*FieldMeta {
+	if this.accept("primary") {
+		for _, field := range fields {
+			if field.IsKey == "PRI" {
+				field.IsKey = ""
+			}
+		}
+		return fields
+	}
+	if this.isKeyword("index", "key", "foreign", "check", "constraint", "partition") {
+		return fields
+	}
+
+	this.accept("column")
+	if this.accept("if") {
+		this.accept("exists")
+	}
+	if index := findField(fields, this.next().text); index >= 0 {
+		fields = append(fields[:index], fields[index+1:]...)
+	}
+	return fields
+}
+
+// MODIFY 列定义 / CHANGE 原列名 列定义, 不改变原有的索引
+func (this *ddlParser) parseChange(fields []*FieldMeta, oldName string) []*FieldMeta {
+	index := findField(fields, oldName)
+	field := this.parseColumn()
+	if index < 0 {
+		return fields
+	}
+
+	if field.IsKey == "" {
+		field.IsKey = fields[index].IsKey
+	}
+	if !this.isKeyword("first", "after") {
+		fields[index] = field
+		return fields
+	}
+
+	fields = append(fields[:index], fields[index+1:]...)
+	return this.insertField(fields, field)
+}
+
+// 按FIRST或AFTER的位置插入列, 默认放在最后
+func (this *ddlParser) insertField(fields []*FieldMeta, field *FieldMeta) []*FieldMeta {
+	index := len(fields)
+	if this.accept("first") {
+		index = 0
+	} else if this.accept("after") {
+		if after := findField(fields, this.next().text); after >= 0 {
+			index = after + 1
+		}
+	}
+
+	fields = append(fields, nil)
+	copy(fields[index+1:], fields[index:])
+	fields[index] = field
+	return fields
+}
+
+// DROP TABLE [IF EXISTS] name[, name...]
+func (this *ddlParser) parseDrop() {
+	if this.accept("if") {
+		this.accept("exists")
+	}
+	for !this.eof() && !this.isKeyword("restrict", "cascade") {
+		if fullName := this.tableName(); nil != this.get(fullName) {
+			this.set(fullName, nil)
+		}
+		this.acceptPunct(",")
+	}
+}
+
+// RENAME TABLE a TO b[, c TO d...]
+func (this *ddlParser) parseRename() {
+	for !this.eof() {
+		fullName := this.tableName()
+		if !this.accept("to") {
+			return
+		}
+		newName := this.tableName()
+		if current := this.get(fullName); nil != current {
+			this.set(fullName, nil)
+			this.set(newName, NewTableMeta(newName, current.Fileds))
+		}
+		this.acceptPunct(",")
+	}
+}
+
+// 列名不区分大小写
+func findField(fields []*FieldMeta, name string) int {
+	for i, field := range fields {
+		if strings.EqualFold(field.ColumnName, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 每个版本的列互不影响
+func copyFields(fields []*FieldMeta) []*FieldMeta {
+	copied := make([]*FieldMeta, 0, len(fields))
+	for _, field := range fields {
+		f := *field
+		copied = append(copied, &f)
+	}
+	return copied
+}
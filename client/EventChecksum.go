@@ -0,0 +1,65 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	. "github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/config"
+	"github.com/SDHM/sqlregret/mysql"
+	"github.com/cihub/seelog"
+)
+
+// 事件校验失败时的处理策略
+const (
+	CORRUPT_FAIL = "fail" // 停止解析
+	CORRUPT_SKIP = "skip" // 跳过该事件, 所在事务标记为不完整
+	CORRUPT_WARN = "warn" // 只告警, 继续解析该事件
+)
+
+// 校验事件的CRC32, header与body为事件头和事件体(body包含最后4字节的校验值)
+// 返回true表示该事件需要跳过
+func (this *LogParser) VerifyEvent(header *LogHeader, headBuf []byte, body []byte) (bool, error) {
+	if this.getChecksumAlg(header, body) != BINLOG_CHECKSUM_ALG_CRC32 {
+		return false, nil
+	}
+
+	if checkEventCRC32(headBuf, body) {
+		return false, nil
+	}
+
+	str := fmt.Sprintf("事件CRC32校验失败 文件:%s\t位置:%d\t事件类型:%d", this.binlogFileName,
+		header.GetLogPos()-header.GetEventLen(), header.GetEventType())
+
+	switch config.G_filterConfig.OnCorrupt {
+	case CORRUPT_SKIP:
+		seelog.Warn(str + "\t跳过该事件")
+		this.GetTransaction().SkipSomeThing()
+		return true, nil
+	case CORRUPT_WARN:
+		seelog.Warn(str)
+		return false, nil
+	default:
+		seelog.Error(str)
+		return false, fmt.Errorf("%s", str)
+	}
+}
+
+// FORMAT_DESCRIPTION_EVENT 自身带有校验算法, 其它事件使用当前的校验算法
+func (this *LogParser) getChecksumAlg(header *LogHeader, body []byte) int {
+	if header.GetEventType() == FORMAT_DESCRIPTION_EVENT {
+		return ParseFormatDescriptionLogEvent(mysql.NewLogBuffer(body), this.context.GetFormatDescription()).GetChecksumAlg()
+	}
+	return this.context.GetFormatDescription().GetChecksumAlg()
+}
+
+func checkEventCRC32(headBuf []byte, body []byte) bool {
+	if len(body) < BINLOG_CHECKSUM_LEN {
+		return false
+	}
+
+	dataLen := len(body) - BINLOG_CHECKSUM_LEN
+	checksum := crc32.Update(crc32.ChecksumIEEE(headBuf), crc32.IEEETable, body[:dataLen])
+	return checksum == binary.LittleEndian.Uint32(body[dataLen:])
+}
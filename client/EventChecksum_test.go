@@ -0,0 +1,54 @@
+package client
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/config"
+	"github.com/SDHM/sqlregret/mysql"
+)
+
+// 构造一个带CRC32的XID事件
+func newChecksumEvent() ([]byte, []byte) {
+	headBuf := make([]byte, binlogevent.LOG_EVENT_HEADER_LEN)
+	headBuf[4] = binlogevent.XID_EVENT
+	binary.LittleEndian.PutUint32(headBuf[9:], uint32(binlogevent.LOG_EVENT_HEADER_LEN+8+4))
+	binary.LittleEndian.PutUint32(headBuf[13:], 1000)
+
+	body := make([]byte, 8, 12)
+	binary.LittleEndian.PutUint64(body, 25)
+	checksum := crc32.ChecksumIEEE(append(append([]byte{}, headBuf...), body...))
+	body = append(body, mysql.Uint32ToBytes(checksum)...)
+	return headBuf, body
+}
+
+func TestVerifyEvent(t *testing.T) {
+	G_transaction = NewTransaction("stdout")
+	parser := &LogParser{binlogFileName: "mysql-bin.000001", context: NewLogContext()}
+	parser.context.formatDescription.checksumAlg = binlogevent.BINLOG_CHECKSUM_ALG_CRC32
+
+	headBuf, body := newChecksumEvent()
+	header := parser.ReadEventHeader(mysql.NewLogBuffer(headBuf))
+
+	config.G_filterConfig.OnCorrupt = CORRUPT_FAIL
+	if skip, err := parser.VerifyEvent(header, headBuf, body); skip || nil != err {
+		t.Fatalf("valid event: skip %v err %v", skip, err)
+	}
+
+	body[0] ^= 0xff
+	if _, err := parser.VerifyEvent(header, headBuf, body); nil == err {
+		t.Fatal("corrupt event should fail")
+	}
+
+	config.G_filterConfig.OnCorrupt = CORRUPT_SKIP
+	if skip, err := parser.VerifyEvent(header, headBuf, body); !skip || nil != err {
+		t.Fatalf("corrupt event should be skipped: skip %v err %v", skip, err)
+	}
+
+	config.G_filterConfig.OnCorrupt = CORRUPT_WARN
+	if skip, err := parser.VerifyEvent(header, headBuf, body); skip || nil != err {
+		t.Fatalf("corrupt event should be parsed: skip %v err %v", skip, err)
+	}
+}
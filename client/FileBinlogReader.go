@@ -6,12 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/config"
 	. "github.com/SDHM/sqlregret/mysql"
 	"github.com/cihub/seelog"
 )
@@ -23,14 +25,17 @@ var (
 
 type FileBinlogReader struct {
 	LogParser
-	fileName  string // binlog文件名
-	pos       int32  //当前位置
-	dbName    string
-	indexFile string
-	basePath  string
-	reader    io.Reader
-	fileArray []string
-	index     int
+	fileName    string // binlog文件名
+	pos         int32  //当前位置
+	dbName      string
+	indexFile   string
+	basePath    string
+	reader      io.Reader
+	closer      io.Closer
+	binlogFiles []string // 指定的binlog文件列表
+	fileArray   []string // binlog文件路径
+	index       int
+	stop        func() bool // 并行解析时不为空, 返回true时停止解析当前文件
 }
 
 func NewFileBinlogReader(dbName string, indexFile string, basePath string) *FileBinlogReader {
@@ -61,35 +66,53 @@ func (this *FileBinlogReader) Register() error {
 //Dump日志
 func (this *FileBinlogReader) Dump(position uint32, filename string) error {
 
-	indexFileName := fmt.Sprintf("%s/%s", this.basePath, this.indexFile)
-	f, err := os.Open(indexFileName)
-	if nil != err {
+	if err := this.loadFileArray(filename); nil != err {
+		seelog.Error("获取binlog文件列表失败:", err.Error())
+		return err
+	}
+
+	if index, err := this.startIndex(filename); nil != err {
+		return err
+	} else {
+		this.index = index
+	}
+
+	if err := this.changeBinlogFile(position, this.fileArray[this.index]); nil != err {
+		seelog.Error("打开文件失败:", err.Error())
 		return err
 	}
 
-	reader := bufio.NewReader(f)
-	this.fileArray = make([]string, 0)
-	index := 0
 	for {
-		if line, _, err := reader.ReadLine(); nil != err {
-			break
-		} else {
-			logFile := strings.Split(string(line), "/")[1]
-			lastSepPos := strings.LastIndex(string(line), "/")
-			logFile = string(line[lastSepPos+1:])
-			if logFile == filename {
-				this.index = index
+		if _, err := this.parseFile(); nil != err {
+			return err
+		}
+
+		if this.index+1 <= len(this.fileArray) {
+			if err := this.changeBinlogFile(4, this.fileArray[this.index]); nil != err {
+				seelog.Error("打开文件失败:", err.Error())
+				return err
 			}
-			this.fileArray = append(this.fileArray, logFile)
-			index++
+		} else {
+			seelog.Debug("到达最后一个文件")
+			break
 		}
 	}
+	return nil
+}
 
-	if err := this.changeBinlogFile(position, filename); nil != err {
-		seelog.Error("打开文件失败:", err.Error())
-		return err
+//开始文件在文件列表中的位置, 没有指定开始文件时从第一个文件开始
+func (this *FileBinlogReader) startIndex(filename string) (int, error) {
+	for index, logFile := range this.fileArray {
+		if filename == "" || TrimCompressSuffix(filepath.Base(logFile)) == TrimCompressSuffix(filename) {
+			return index, nil
+		}
 	}
+	return -1, fmt.Errorf("开始文件%s不在binlog文件列表中", filename)
+}
 
+//解析当前文件直到文件末尾
+//并行解析时超出结束时间或结束位置不退出进程, 返回true由调用者按文件顺序结束
+func (this *FileBinlogReader) parseFile() (bool, error) {
 	for {
 		if headBuf, err := this.ReadHeader(); nil == err {
 			logBBF := NewLogBuffer(headBuf)
@@ -104,14 +127,29 @@ func (this *FileBinlogReader) Dump(position uint32, filename string) error {
 				seelog.Error("read packet faield!", err.Error())
 				// this.SwitchLogFile(this.fileArray[this.index+1], 4)
 			} else {
+				if skip, err := this.VerifyEvent(header, headBuf, by); nil != err {
+					return false, err
+				} else if skip {
+					continue
+				}
+
 				timeSnap := time.Unix(header.timeSnamp, 0)
 
+				if nil != this.stop {
+					if ReachEndTime(timeSnap) || ReachEndPos(this.fileIndex, header.GetLogPos()) {
+						return true, nil
+					} else if this.stop() {
+						return false, nil
+					}
+				}
+
 				if FilterTime(timeSnap, header.GetEventType()) {
 					continue
 				}
 
 				if FilterMode(header.GetEventType()) {
 					this.StoreTimePos(timeSnap, this.binlogFileName, header.GetLogPos())
+					this.markTimePos(header.GetEventType(), timeSnap, header.GetLogPos())
 					continue
 				}
 
@@ -119,7 +157,7 @@ func (this *FileBinlogReader) Dump(position uint32, filename string) error {
 					continue
 				}
 
-				if FilterSkipSQL(header.GetEventType()) {
+				if FilterSkipSQL(header.GetEventType(), this.GetTransaction()) {
 					continue
 				}
 
@@ -142,20 +180,115 @@ func (this *FileBinlogReader) Dump(position uint32, filename string) error {
 			}
 
 		} else if err == io.EOF {
-			if this.index+1 <= len(this.fileArray) {
-				this.changeBinlogFile(4, this.fileArray[this.index])
-			} else {
-				seelog.Debug("到达最后一个文件")
-				break
-			}
+			return false, nil
+		}
+	}
+}
+
+//设置要解析的binlog文件列表, 设置后不再读取索引文件
+func (this *FileBinlogReader) SetBinlogFiles(binlogFiles []string) {
+	this.binlogFiles = binlogFiles
+}
+
+//获取要解析的binlog文件路径, 优先使用指定的文件列表, 其次是索引文件, 都没有时扫描目录
+func (this *FileBinlogReader) loadFileArray(startFile string) error {
+	this.fileArray = make([]string, 0)
+
+	if len(this.binlogFiles) > 0 {
+		for _, logFile := range this.binlogFiles {
+			this.fileArray = append(this.fileArray, this.binlogFilePath(logFile))
+		}
+		return sortBinlogFiles(this.fileArray)
+	}
+
+	if this.indexFile == "" {
+		fileArray, err := scanBinlogFiles(this.basePath, startFile)
+		if nil != err {
+			return err
+		}
+		this.fileArray = fileArray
+		return nil
+	}
+
+	indexFileName := fmt.Sprintf("%s/%s", this.basePath, this.indexFile)
+	f, err := os.Open(indexFileName)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	//索引文件中的每一行如 ./mysql-bin.000001, 只取文件名
+	reader := bufio.NewReader(f)
+	for {
+		if line, _, err := reader.ReadLine(); nil != err {
+			break
+		} else if logFile := strings.TrimSpace(string(line)); logFile != "" {
+			this.fileArray = append(this.fileArray, this.binlogFilePath(filepath.Base(logFile)))
 		}
 	}
+
+	if len(this.fileArray) == 0 {
+		return fmt.Errorf("索引文件%s中没有binlog文件", indexFileName)
+	}
 	return nil
 }
 
+//列出binlog文件名, 按序号排序, 目录下有多种前缀时只列出与startFile前缀相同的文件
+func (this *FileBinlogReader) ListBinlogFiles(startFile string) ([]string, error) {
+	if err := this.loadFileArray(startFile); nil != err {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(this.fileArray))
+	for _, logFile := range this.fileArray {
+		files = append(files, TrimCompressSuffix(filepath.Base(logFile)))
+	}
+	return files, nil
+}
+
+//读取binlog文件第一个事件的时间, 只读取文件头与第一个事件头
+func (this *FileBinlogReader) GetFirstEventTime(fileName string) (time.Time, error) {
+	path := this.binlogFilePath(fileName)
+	for _, logFile := range this.fileArray {
+		if TrimCompressSuffix(filepath.Base(logFile)) == TrimCompressSuffix(fileName) {
+			path = logFile
+			break
+		}
+	}
+
+	reader, closer, err := openBinlogFile(path)
+	if nil != err {
+		return time.Time{}, err
+	}
+	defer closer.Close()
+
+	buf := make([]byte, len(binlogFileHeader)+binlogevent.LOG_EVENT_HEADER_LEN)
+	if _, err := io.ReadFull(reader, buf); nil != err {
+		return time.Time{}, fmt.Errorf("读取binlog文件%s失败:%v", path, err)
+	} else if !bytes.Equal(buf[:len(binlogFileHeader)], binlogFileHeader) {
+		return time.Time{}, errors.New(path + " is not a valid binlog file, head 4 bytes must fe'bin' ")
+	}
+
+	header := this.ReadEventHeader(NewLogBuffer(buf[len(binlogFileHeader):]))
+	return time.Unix(header.timeSnamp, 0), nil
+}
+
+//相对路径的文件在basePath下
+func (this *FileBinlogReader) binlogFilePath(logFile string) string {
+	if filepath.IsAbs(logFile) {
+		return logFile
+	}
+	return filepath.Join(this.basePath, logFile)
+}
+
+//文件模式下没有master, 无法按GTID定位
+func (this *FileBinlogReader) DumpGtid(gtidSet *GtidSet) error {
+	return errors.New("文件模式不支持按GTID集合dump")
+}
+
 func (this *FileBinlogReader) StoreTimePos(t time.Time, fileName string, pos int64) {
-	//十秒钟一个记录
-	if t.Sub(lastLogTime) >= time.Second*10 {
+	//按--mark-interval的间隔记录
+	if t.Sub(lastLogTime) >= time.Duration(config.G_filterConfig.MarkInterval)*time.Second {
 		str := fmt.Sprintf("时间:%s\t文件名:%s\t位置:%d", t.Format("2006-01-02 15:04:05"), fileName, pos)
 		fmt.Println(str)
 		lastLogTime = t
@@ -163,34 +296,102 @@ func (this *FileBinlogReader) StoreTimePos(t time.Time, fileName string, pos int
 }
 
 func (this *FileBinlogReader) changeBinlogFile(position uint32, filename string) error {
-	if this.reader != nil {
-		if f := this.reader.(*os.File); nil != f {
-			f.Close()
-			this.reader = nil
-		}
+	if this.closer != nil {
+		this.closer.Close()
+		this.closer = nil
+		this.reader = nil
 	}
 
-	this.binlogFileName = filename
-	fileIndex, _ := strconv.Atoi(strings.Split(filename, ".")[1])
+	this.binlogFileName = TrimCompressSuffix(filepath.Base(filename))
+	fileIndex, err := BinlogFileIndex(filename)
+	if nil != err {
+		return err
+	}
 	this.fileIndex = fileIndex
 
-	filename = fmt.Sprintf("%s/%s", this.basePath, filename)
-	f, err := os.Open(filename)
+	reader, closer, err := openBinlogFile(filename)
 	if nil != err {
 		return err
 	}
 
+	this.index = this.index + 1
+	if err := this.startStream(reader, closer, position, filename); nil != err {
+		return err
+	}
+
+	// seelog.Debug("切换文件:", filename)
+	return nil
+}
+
+//校验binlog文件头, position大于4时跳到position
+func (this *FileBinlogReader) startStream(reader io.Reader, closer io.Closer, position uint32, filename string) error {
+	this.reader = reader
+	this.closer = closer
+
 	b := make([]byte, 4)
-	if _, err = f.Read(b); err != nil {
+	if _, err := io.ReadFull(reader, b); err != nil {
+		this.Close()
 		return err
 	} else if !bytes.Equal(b, binlogFileHeader) {
+		this.Close()
 		return errors.New(filename + " is not a valid binlog file, head 4 bytes must fe'bin' ")
 	}
 
-	this.reader = f
-	this.index = this.index + 1
+	if position > uint32(len(binlogFileHeader)) {
+		if err := this.seekPosition(int64(position)); nil != err {
+			this.Close()
+			return err
+		}
+	}
+	return nil
+}
 
-	// seelog.Debug("切换文件:", filename)
+//读取文件头的FORMAT_DESCRIPTION_EVENT后直接跳到position, 并校验position是一个事件的起始位置
+func (this *FileBinlogReader) seekPosition(position int64) error {
+	headBuf, err := this.ReadHeader()
+	if nil != err {
+		return err
+	}
+
+	header := this.ReadEventHeader(NewLogBuffer(headBuf))
+	if header.GetEventType() != FORMAT_DESCRIPTION_EVENT {
+		return fmt.Errorf("%s的第一个事件不是FORMAT_DESCRIPTION_EVENT", this.binlogFileName)
+	}
+
+	by, err := this.ReadPacket(header.GetEventLen() - binlogevent.LOG_EVENT_HEADER_LEN)
+	if nil != err {
+		return err
+	}
+	this.Parse(header, NewLogBuffer(by), this.SwitchLogFile)
+
+	offset := header.GetLogPos()
+	if position < offset {
+		return fmt.Errorf("位置%d不是%s中事件的起始位置, 第一个可用位置为%d", position, this.binlogFileName, offset)
+	}
+
+	//未压缩的文件直接seek, 压缩文件只能顺序读取跳过
+	if f, ok := this.closer.(*os.File); ok {
+		if _, err := f.Seek(position, io.SeekStart); nil != err {
+			return err
+		}
+		this.reader = bufio.NewReader(f)
+	} else if _, err := io.CopyN(ioutil.Discard, this.reader, position-offset); nil != err {
+		return fmt.Errorf("位置%d超出了%s的长度", position, this.binlogFileName)
+	}
+
+	headBuf = make([]byte, binlogevent.LOG_EVENT_HEADER_LEN)
+	if _, err := io.ReadFull(this.reader, headBuf); nil != err {
+		return fmt.Errorf("位置%d超出了%s的长度", position, this.binlogFileName)
+	}
+
+	//事件头中的结束位置必须等于起始位置加事件长度
+	header = this.ReadEventHeader(NewLogBuffer(headBuf))
+	if header.GetEventLen() < binlogevent.LOG_EVENT_HEADER_LEN || header.GetLogPos() != position+header.GetEventLen() {
+		return fmt.Errorf("位置%d不是%s中事件的起始位置", position, this.binlogFileName)
+	}
+
+	//把读出的事件头放回去
+	this.reader = io.MultiReader(bytes.NewReader(headBuf), this.reader)
 	return nil
 }
 
@@ -231,6 +432,11 @@ func (this *FileBinlogReader) SwitchLogFile(fileName string, pos int64) error {
 
 //关闭连接
 func (this *FileBinlogReader) Close() error {
+	if this.closer != nil {
+		this.closer.Close()
+		this.closer = nil
+		this.reader = nil
+	}
 	return nil
 }
 
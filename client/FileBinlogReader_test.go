@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/mysql"
+)
+
+// 构造一个事件, pos为事件的起始位置
+func newTestEvent(eventType byte, pos int, body []byte) []byte {
+	event := make([]byte, binlogevent.LOG_EVENT_HEADER_LEN, binlogevent.LOG_EVENT_HEADER_LEN+len(body))
+	event[4] = eventType
+	binary.LittleEndian.PutUint32(event[9:], uint32(len(event)+len(body)))
+	binary.LittleEndian.PutUint32(event[13:], uint32(pos+len(event)+len(body)))
+	return append(event, body...)
+}
+
+// 文件头 + FORMAT_DESCRIPTION_EVENT + events, 返回每个事件的起始位置
+func newTestBinlogFile(t *testing.T, path string, events ...[]byte) []int {
+	fde := make([]byte, 2+binlogevent.ST_SERVER_VER_LEN+4+1, 2+binlogevent.ST_SERVER_VER_LEN+4+1+40)
+	binary.LittleEndian.PutUint16(fde, 4)
+	copy(fde[2:], "5.5.60-log")
+	fde[2+binlogevent.ST_SERVER_VER_LEN+4] = binlogevent.LOG_EVENT_HEADER_LEN
+	postHeaderLen := make([]byte, 40)
+	postHeaderLen[binlogevent.QUERY_EVENT-1] = binlogevent.QUERY_HEADER_LEN
+	fde = append(fde, postHeaderLen...)
+
+	data := append([]byte{}, binlogFileHeader...)
+	data = append(data, newTestEvent(binlogevent.FORMAT_DESCRIPTION_EVENT, len(data), fde)...)
+
+	positions := make([]int, 0, len(events))
+	for _, event := range events {
+		positions = append(positions, len(data))
+		data = append(data, newTestEvent(event[0], len(data), event[1:])...)
+	}
+
+	if err := os.WriteFile(path, data, 0644); nil != err {
+		t.Fatal(err)
+	}
+	return positions
+}
+
+// 事件类型 + 事件体
+func newTestXidEvent() []byte {
+	return append([]byte{binlogevent.XID_EVENT}, make([]byte, 8)...)
+}
+
+func TestSeekPosition(t *testing.T) {
+	dir := t.TempDir()
+	pos := newTestBinlogFile(t, filepath.Join(dir, "mysql-bin.000001"), newTestXidEvent(), newTestXidEvent())[1]
+
+	reader := NewFileBinlogReader("", "", dir)
+	defer reader.Close()
+	if err := reader.changeBinlogFile(uint32(pos), filepath.Join(dir, "mysql-bin.000001")); nil != err {
+		t.Fatal(err)
+	}
+
+	headBuf, err := reader.ReadHeader()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if header := reader.ReadEventHeader(mysql.NewLogBuffer(headBuf)); header.GetLogPos() != int64(pos+binlogevent.LOG_EVENT_HEADER_LEN+8) {
+		t.Fatalf("got event end %d", header.GetLogPos())
+	}
+
+	if err := reader.changeBinlogFile(uint32(pos+1), filepath.Join(dir, "mysql-bin.000001")); nil == err {
+		t.Fatal("position inside an event should fail")
+	}
+}
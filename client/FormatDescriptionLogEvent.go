@@ -115,6 +115,9 @@ func NewFormatDesctiptionLogEvent(binlogVersion int) *FormatDescriptionLogEvent
 				TRANSACTION_CONTEXT_HEADER_LEN,
 				VIEW_CHANGE_HEADER_LEN,
 				XA_PREPARE_HEADER_LEN,
+				ROWS_HEADER_LEN_V2, /* PARTIAL_UPDATE_ROWS_EVENT*/
+				0,                  /* TRANSACTION_PAYLOAD_EVENT*/
+				0,                  /* HEARTBEAT_LOG_EVENT_V2*/
 			}
 		}
 	default:
@@ -151,6 +154,10 @@ func (this *FormatDescriptionLogEvent) GetVersionSum() int {
 	return this.versionSum
 }
 
+func (this *FormatDescriptionLogEvent) IsMariadb() bool {
+	return strings.Contains(this.serverVersion, "MariaDB")
+}
+
 func (this *FormatDescriptionLogEvent) GetCommonHeaderLen() int {
 	return this.commonHeaderLen
 }
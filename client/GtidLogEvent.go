@@ -0,0 +1,25 @@
+package client
+
+import (
+	. "github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/mysql"
+)
+
+func ParseGtidLogEvent(logBuf *mysql.LogBuffer, descriptionEvent *FormatDescriptionLogEvent) *Gtid_event {
+	this := new(Gtid_event)
+	this.CommitFlag = logBuf.GetUInt8() != 0
+
+	this.SID = make([]byte, ENCODED_SID_LENGTH)
+	copy(this.SID, logBuf.GetVarLenBytes(ENCODED_SID_LENGTH))
+	this.GNO = logBuf.GetInt64()
+
+	//5.7.6之前没有逻辑时间戳
+	if logBuf.GetRestLen() >= LOGICAL_TIMESTAMP_TYPECODE_LENGTH+LOGICAL_TIMESTAMP_LENGTH {
+		if logBuf.GetUInt8() == LOGICAL_TIMESTAMP_TYPECODE {
+			this.LastCommitted = logBuf.GetInt64()
+			this.SequenceNumber = logBuf.GetInt64()
+		}
+	}
+
+	return this
+}
@@ -1,6 +1,8 @@
 package client
 
 import (
+	"time"
+
 	. "github.com/SDHM/sqlregret/mysql"
 )
 
@@ -20,6 +22,15 @@ type IBinlogReader interface {
 	//Dump日志
 	Dump(position uint32, filename string) error
 
+	//按GTID集合Dump日志
+	DumpGtid(gtidSet *GtidSet) error
+
+	//列出binlog文件, 按先后顺序
+	ListBinlogFiles(startFile string) ([]string, error)
+
+	//读取binlog文件第一个事件的时间
+	GetFirstEventTime(fileName string) (time.Time, error)
+
 	//读取日志头
 	ReadHeader() ([]byte, error)
 
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +23,37 @@ type LogParser struct {
 	fileIndex      int
 	context        *LogContext
 	tableMetaCache *TableMetaCache
+	timePosIndex   *TimePosIndex // mark模式下不为空时把时间点保存到索引文件
+	transaction    *Transaction  // 为空时使用G_transaction, 并行解析时每个文件一个
+}
+
+//当前解析使用的事务
+func (this *LogParser) GetTransaction() *Transaction {
+	if nil != this.transaction {
+		return this.transaction
+	}
+	return G_transaction
+}
+
+//设置mark模式下保存时间点的索引
+func (this *LogParser) SetTimePosIndex(timePosIndex *TimePosIndex) {
+	this.timePosIndex = timePosIndex
+}
+
+//事务结束(XID_EVENT)的位置是完整事务的边界, 从这里开始解析不会只读到半个事务
+func (this *LogParser) markTimePos(eventType int, t time.Time, pos int64) {
+	if nil == this.timePosIndex || eventType != XID_EVENT {
+		return
+	}
+
+	gtid := ""
+	if sid, gno := this.GetTransaction().GetGtidNo(); nil != sid && gno > 0 {
+		gtid = fmt.Sprintf("%s:%d", mysql.FormatSID(sid), gno)
+	}
+
+	if err := this.timePosIndex.Add(t, this.binlogFileName, pos, gtid); nil != err {
+		seelog.Error("保存时间点失败:", err.Error())
+	}
 }
 
 func (this *LogParser) Parse(header *LogHeader, logBuf *mysql.LogBuffer, SwitchFile func(string, int64) error) {
@@ -41,7 +74,7 @@ func (this *LogParser) Parse(header *LogHeader, logBuf *mysql.LogBuffer, SwitchF
 		}
 	case TABLE_MAP_EVENT:
 		{
-			this.ReadTableMapEvent(logBuf)
+			this.ReadTableMapEvent(header, logBuf)
 		}
 	case WRITE_ROWS_EVENT_V1, WRITE_ROWS_EVENT:
 		{
@@ -49,7 +82,7 @@ func (this *LogParser) Parse(header *LogHeader, logBuf *mysql.LogBuffer, SwitchF
 			// fmt.Println("eventType: WRITE logBuf:", logBuf.GetRestLen())
 			this.ReadRowEvent(header, event_type, logBuf)
 		}
-	case UPDATE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT:
+	case UPDATE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT, PARTIAL_UPDATE_ROWS_EVENT:
 		{
 
 			// fmt.Println("eventType: UPDATE logBuf:", logBuf.GetRestLen())
@@ -67,9 +100,15 @@ func (this *LogParser) Parse(header *LogHeader, logBuf *mysql.LogBuffer, SwitchF
 				this.ReadRowsQueryEvent(header, event_type, logBuf)
 			}
 		}
+	case ANNOTATE_ROWS_EVENT:
+		{
+			if config.G_filterConfig.Origin {
+				this.ReadAnnotateRowsEvent(header, logBuf)
+			}
+		}
 	case USER_VAR_EVENT:
 		{
-			fmt.Println("USER_VAR_EVENT NOT HANDLE")
+			this.GetTransaction().Printf("USER_VAR_EVENT NOT HANDLE\n")
 		}
 	case INTVAR_EVENT:
 		{
@@ -81,7 +120,7 @@ func (this *LogParser) Parse(header *LogHeader, logBuf *mysql.LogBuffer, SwitchF
 		}
 	case STOP_EVENT:
 		{
-			fmt.Println("STOP_EVENT HAPPEND!")
+			this.GetTransaction().Printf("STOP_EVENT HAPPEND!\n")
 		}
 	case FORMAT_DESCRIPTION_EVENT:
 		{
@@ -90,26 +129,34 @@ func (this *LogParser) Parse(header *LogHeader, logBuf *mysql.LogBuffer, SwitchF
 		}
 	case GTID_EVENT:
 		{
-			// fmt.Println("GTID_EVENT NOT HANDLE")
+			this.ReadMariadbGtidEvent(header, logBuf)
 		}
 	case GTID_LIST_EVENT:
 		{
-			// fmt.Println("GTID_LIST_EVENT NOT HANDLE")
+			this.ReadMariadbGtidListEvent(logBuf)
+		}
+	case HEARTBEAT_LOG_EVENT, HEARTBEAT_LOG_EVENT_V2:
+		{
+			// master空闲时的心跳, 不需要处理
+		}
+	case BINLOG_CHECKPOINT_EVENT:
+		{
+			// fmt.Println("BINLOG_CHECKPOINT_EVENT NOT HANDLE")
 		}
 	case ANONYMOUS_GTID_LOG_EVENT:
 		{
-			// fmt.Println("ANONYMOUS_GTID_EVENT NOT HANDLE")
+			this.ReadGtidLogEvent(logBuf)
 		}
 	case PREVIOUS_GTIDS_LOG_EVENT:
 		{
-			// fmt.Println("PREVIOUS_GTIDS_EVENT NOT HANDLE")
+			this.ReadPreviousGtidsEvent(logBuf)
 		}
 	case GTID_LOG_EVENT:
 		{
-			// fmt.Println("GTID_LOG_EVENT NOT HANDLE")
+			this.ReadGtidLogEvent(logBuf)
 		}
 	default:
-		fmt.Println("接收到未识别的命令头：", event_type)
+		this.GetTransaction().Printf("接收到未识别的命令头： %d\n", event_type)
 	}
 }
 
@@ -117,7 +164,7 @@ func getEventType(event_type int) protocol.EventType {
 	switch event_type {
 	case WRITE_ROWS_EVENT_V1, WRITE_ROWS_EVENT:
 		return protocol.EventType_INSERT
-	case UPDATE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT:
+	case UPDATE_ROWS_EVENT_V1, UPDATE_ROWS_EVENT, PARTIAL_UPDATE_ROWS_EVENT:
 		return protocol.EventType_UPDATE
 	case DELETE_ROWS_EVENT_V1, DELETE_ROWS_EVENT:
 		return protocol.EventType_DELETE
@@ -134,6 +181,12 @@ func (this *LogParser) ReadEventHeader(logBuf *mysql.LogBuffer) *LogHeader {
 func (this *LogParser) ReadFormatDescriptionEvent(logbuf *mysql.LogBuffer) {
 	descriptionEvent := ParseFormatDescriptionLogEvent(logbuf, this.context.GetFormatDescription())
 	this.context.SetFormatDescription(descriptionEvent)
+
+	//--gtid按MySQL的server_uuid:序号匹配, MariaDB的domain-server-seq不能匹配, 否则会过滤掉所有事务
+	if nil != config.G_filterConfig.GtidSet && descriptionEvent.IsMariadb() {
+		fmt.Println("MariaDB的binlog不支持--gtid过滤")
+		os.Exit(1)
+	}
 }
 
 func (this *LogParser) ReadQueryEvent(logHeader *LogHeader, logbuf *mysql.LogBuffer) {
@@ -142,49 +195,117 @@ func (this *LogParser) ReadQueryEvent(logHeader *LogHeader, logbuf *mysql.LogBuf
 	case "begin":
 		{
 			//fmt.Println("\n开始事务")
-			G_transaction.Begin(queryEvent.GetTime(), this.binlogFileName, logHeader.GetLogPos())
+			this.GetTransaction().Begin(queryEvent.GetTime(), this.binlogFileName, logHeader.GetLogPos())
 		}
 	case "commit":
 		{
-			fmt.Println("提交事务2")
+			this.GetTransaction().Printf("提交事务2\n")
 		}
 	default:
 		{
+			//不论是否输出DDL都要维护表结构历史
+			if nil != this.tableMetaCache {
+				this.tableMetaCache.ApplyDDL(queryEvent.GetSchema(), queryEvent.GetQuery(), this.fileIndex, logHeader.GetLogPos())
+			}
+
 			//如果开放DDL解析，则解析DDL,否则不解析
 			if config.G_filterConfig.WithDDL {
-				if strings.Contains(sql, "alter table") {
-					s := strings.Split(sql, " ")
-					for index := range s {
-						if s[index] == "table" {
-							if index+1 < len(s) {
-								tableName := s[index+1]
-								this.getTableMeta(queryEvent.GetSchema(), tableName, true)
-							}
-							break
-						}
-					}
-					fmt.Printf("修改表结构语句:%s\n", sql)
-				} else {
-					fmt.Printf("DDL语句:%s\n", sql)
-				}
+				this.ReadDDLEvent(logHeader, queryEvent)
 			}
+		}
+	}
+
+}
 
+//按类型与库表过滤后输出DDL语句, 用于审计谁在什么时候删除、清空了哪些表
+func (this *LogParser) ReadDDLEvent(logHeader *LogHeader, queryEvent *QueryLogEvent) {
+	ddlEvent := ParseDDLEvent(queryEvent.GetSchema(), queryEvent.GetQuery())
+
+	//修改表结构后从数据库重新获取
+	if ddlEvent.EventType == protocol.EventType_ALTER {
+		for _, table := range ddlEvent.Tables {
+			this.getTableMeta(table.DbName, table.TblName, true)
 		}
 	}
 
+	if !config.G_filterConfig.WithDDLType(ddlEvent.EventType.String()) ||
+		!ddlEvent.MatchTable(config.G_filterConfig.FilterDb, config.G_filterConfig.FilterTable) ||
+		!this.GetTransaction().MatchGtid() {
+		return
+	}
+
+	row_change := new(protocol.RowChange)
+	row_change.SetEventType(ddlEvent.EventType)
+	row_change.SetIsDdl(true)
+	row_change.SetSql(ddlEvent.Sql)
+	row_change.SetDdlSchemaName(ddlEvent.Schema)
+	if _, err := proto.Marshal(row_change); nil != err {
+		fmt.Println("Marshal failed!", err.Error())
+	}
+
+	executeTime := time.Unix(logHeader.GetExecuteTime(), 0).Format("2006-01-02 15:04:05")
+	this.GetTransaction().Printf("DDL语句:%s\n时间:%s\t线程:%d\t类型:%s\t表:%s\n",
+		ddlEvent.Sql, executeTime, queryEvent.GetSessionId(), ddlEvent.TypeName(), ddlEvent.TableNames())
 }
 
-func (this *LogParser) ReadTableMapEvent(logbuf *mysql.LogBuffer) {
+func (this *LogParser) ReadTableMapEvent(logHeader *LogHeader, logbuf *mysql.LogBuffer) {
 	tableMapEvent := ParseTableMapLogEvent(logbuf, this.context.GetFormatDescription())
+	//binlog中没有记录表结构时使用该位置上生效的表结构
+	if nil == tableMapEvent.TableMeta && nil != this.tableMetaCache {
+		tableMapEvent.TableMeta = this.tableMetaCache.GetTableMetaAt(
+			tableMapEvent.DbName+"."+tableMapEvent.TblName, this.fileIndex, logHeader.GetLogPos())
+	}
 	this.context.PutTable(tableMapEvent)
 }
 
+func (this *LogParser) ReadGtidLogEvent(logbuf *mysql.LogBuffer) {
+	gtidEvent := ParseGtidLogEvent(logbuf, this.context.GetFormatDescription())
+	this.GetTransaction().SetGtid(gtidEvent)
+}
+
+func (this *LogParser) ReadPreviousGtidsEvent(logbuf *mysql.LogBuffer) {
+	if previousGtidsEvent, err := ParsePreviousGtidLogEvent(logbuf, this.context.GetFormatDescription()); nil != err {
+		seelog.Error("解析PREVIOUS_GTIDS_LOG_EVENT失败:", err.Error())
+	} else {
+		seelog.Debugf("文件:%s\t之前的GTID集合:%s", this.binlogFileName, previousGtidsEvent.String())
+	}
+}
+
+func (this *LogParser) ReadMariadbGtidEvent(logHeader *LogHeader, logbuf *mysql.LogBuffer) {
+	gtidEvent := ParseMariadbGtidEvent(logHeader, logbuf, this.context.GetFormatDescription())
+
+	//MariaDB的GTID事件代替了BEGIN
+	if !gtidEvent.IsStandalone() {
+		timeSnap := time.Unix(logHeader.timeSnamp, 0)
+		this.GetTransaction().Begin(timeSnap.Format("2006-01-02 15:04:05"), this.binlogFileName, logHeader.GetLogPos())
+	}
+	this.GetTransaction().SetMariadbGtid(gtidEvent)
+}
+
+func (this *LogParser) ReadMariadbGtidListEvent(logbuf *mysql.LogBuffer) {
+	gtidListEvent := ParseMariadbGtidListEvent(logbuf, this.context.GetFormatDescription())
+	seelog.Debugf("文件:%s\t之前的GTID列表:%s", this.binlogFileName, gtidListEvent.String())
+}
+
 func (this *LogParser) ReadRowsQueryEvent(logHeader *LogHeader, event_type int, logbuf *mysql.LogBuffer) {
 	rowsQueryEvent := ParseRowsQueryEvent(logbuf, this.context.GetFormatDescription())
-	timeSnap := time.Unix(logHeader.timeSnamp, 0)
+	this.appendOriginSQL(logHeader, rowsQueryEvent.GetRowsQueryString())
+}
 
-	fmt.Printf("时间戳:%s\t原始语句为:%s;\n", timeSnap.Format("2006-01-02 15:04:05"), rowsQueryEvent.GetRowsQueryString())
+func (this *LogParser) ReadAnnotateRowsEvent(logHeader *LogHeader, logbuf *mysql.LogBuffer) {
+	annotateRowsEvent := ParseAnnotateRowsEvent(logbuf, this.context.GetFormatDescription())
+	this.appendOriginSQL(logHeader, annotateRowsEvent.GetRowsQueryString())
+}
 
+// 原始语句附加到所在的事务中输出
+func (this *LogParser) appendOriginSQL(logHeader *LogHeader, query string) {
+	if config.G_filterConfig.Mode == "pre" {
+		return
+	}
+
+	timeSnap := time.Unix(logHeader.timeSnamp, 0)
+	str := fmt.Sprintf("时间戳:%s\t原始语句为:%s;\n", timeSnap.Format("2006-01-02 15:04:05"), query)
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, str, !config.G_filterConfig.Dump))
 }
 
 func (this *LogParser) ReadRowEvent(logHeader *LogHeader, event_type int, logbuf *mysql.LogBuffer) {
@@ -209,12 +330,11 @@ func (this *LogParser) ReadRowEvent(logHeader *LogHeader, event_type int, logbuf
 
 	column_count, _ := logbuf.GetVarLen()
 
-	//columns-present-bitmap1 := logbuf.GetVarLenBytes((int(column_count) + 7) / 8)
-	logbuf.SkipLen((int(column_count) + 7) / 8)
+	columnsPresent1 := logbuf.GetVarLenBytes((int(column_count) + 7) / 8)
 
-	if event_type == UPDATE_ROWS_EVENT_V1 || event_type == UPDATE_ROWS_EVENT {
-		//columns-present-bitmap2 := logbuf.GetVarLenBytes((int(column_count) + 7) / 8)
-		logbuf.SkipLen((int(column_count) + 7) / 8)
+	var columnsPresent2 []byte
+	if event_type == UPDATE_ROWS_EVENT_V1 || event_type == UPDATE_ROWS_EVENT || event_type == PARTIAL_UPDATE_ROWS_EVENT {
+		columnsPresent2 = logbuf.GetVarLenBytes((int(column_count) + 7) / 8)
 	}
 	tableMapEvent := this.context.GetTable(table_id)
 	columns := tableMapEvent.ColumnInfo
@@ -247,12 +367,17 @@ func (this *LogParser) ReadRowEvent(logHeader *LogHeader, event_type int, logbuf
 	// fmt.Println("configTb:", config.G_filterConfig.FilterDb)
 
 	//列过滤
-	tableMeta := this.getTableMeta(tableMapEvent.DbName, tableMapEvent.TblName, false)
+	tableMeta := this.getTableMapMeta(tableMapEvent)
 	if FilterColumns(eventType, tableMeta, columns) {
 		return
 	}
 
-	rows := this.ReadRows(logHeader, tableMapEvent, eventType, columns, logbuf)
+	var rows []*protocol.RowData
+	if event_type == PARTIAL_UPDATE_ROWS_EVENT {
+		rows = this.ReadPartialRows(logHeader, tableMapEvent, columns, columnsPresent1, columnsPresent2, logbuf)
+	} else {
+		rows = this.ReadRows(logHeader, tableMapEvent, eventType, columns, logbuf)
+	}
 
 	row_change := new(protocol.RowChange)
 	row_change.SetTableId(table_id)
@@ -271,8 +396,8 @@ func (this *LogParser) ReadRowEvent(logHeader *LogHeader, event_type int, logbuf
 
 func (this *LogParser) ReadXidEvent(logHeader *LogHeader, logbuf *mysql.LogBuffer) {
 	xid := int64(logbuf.GetUInt64())
-	G_transaction.End(xid)
-	G_transaction.PrintTransaction()
+	this.GetTransaction().End(xid)
+	this.GetTransaction().PrintTransaction()
 	// fmt.Printf("提交事务:%d\n\n", xid)
 }
 
@@ -320,6 +445,8 @@ func (this *LogParser) isSqlTypeString(sqlType JavaType) bool {
 	isString := false
 	switch sqlType {
 	case INTEGER, TINYINT, SMALLINT, BIGINT, BIT:
+	case STRUCT:
+		//值为SQL表达式, 如GEOMETRY的构造函数、不能转换字符集的字符串
 	case REAL, TIMESTAMP, TIME, DATE, CHAR, VARCHAR, BINARY, VARBINARY, LONGVARBINARY:
 		isString = true
 	case DOUBLE, DECIMAL:
@@ -362,11 +489,11 @@ func (this *LogParser) transformToSqlInsert(logHeader *LogHeader, tableMapEvent
 	timeSnap := time.Unix(logHeader.timeSnamp, 0)
 	rstSql := fmt.Sprintf("时间戳:%s\tpos:%d\t插入语句为:", timeSnap.Format("2006-01-02 15:04:05"), logHeader.GetLogPos())
 
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(false, sql+";", !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, sql+";", !config.G_filterConfig.Dump))
 
 	if !config.G_filterConfig.NeedReverse {
-		G_transaction.AppendSQL(&timeSnap, NewShowSql(true, "\n", true))
+		this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, "\n", true))
 		return
 	}
 
@@ -386,8 +513,8 @@ func (this *LogParser) transformToSqlInsert(logHeader *LogHeader, tableMapEvent
 	}
 
 	rstSql = fmt.Sprintf("\t对应的反向insert语句:")
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(false, sql+"\n", true))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, sql+"\n", true))
 }
 
 func (this *LogParser) transformToSqlDelete(logHeader *LogHeader, tableMapEvent *TableMapLogEvent, columns []*protocol.Column) {
@@ -410,11 +537,11 @@ func (this *LogParser) transformToSqlDelete(logHeader *LogHeader, tableMapEvent
 	timeSnap := time.Unix(logHeader.timeSnamp, 0)
 	rstSql := fmt.Sprintf("时间戳:%s\tpos:%d\t删除语句为:", timeSnap.Format("2006-01-02 15:04:05"), logHeader.GetLogPos())
 
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(false, sql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, sql, !config.G_filterConfig.Dump))
 
 	if !config.G_filterConfig.NeedReverse {
-		G_transaction.AppendSQL(&timeSnap, NewShowSql(true, "\n", true))
+		this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, "\n", true))
 		return
 	}
 
@@ -446,8 +573,8 @@ func (this *LogParser) transformToSqlDelete(logHeader *LogHeader, tableMapEvent
 	}
 
 	rstSql = fmt.Sprintf("\t对应的反向insert语句:")
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(false, regretsql+";\n", true))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, regretsql+";\n", true))
 }
 
 func (this *LogParser) transformToSqlUpdate(logHeader *LogHeader, tableMapEvent *TableMapLogEvent, before []*protocol.Column, after []*protocol.Column) {
@@ -594,11 +721,11 @@ func (this *LogParser) transformToSqlUpdate(logHeader *LogHeader, tableMapEvent
 	timeSnap := time.Unix(logHeader.timeSnamp, 0)
 	rstSql := fmt.Sprintf("时间戳:%s\tpos:%d\tupdate语句:", timeSnap.Format("2006-01-02 15:04:05"), logHeader.GetLogPos())
 
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(false, sql+";", !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, sql+";", !config.G_filterConfig.Dump))
 
 	if !config.G_filterConfig.NeedReverse {
-		G_transaction.AppendSQL(&timeSnap, NewShowSql(true, "\n", true))
+		this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, "\n", true))
 		return
 	}
 
@@ -683,8 +810,54 @@ func (this *LogParser) transformToSqlUpdate(logHeader *LogHeader, tableMapEvent
 
 	sqlregret += fmt.Sprintf(" where %s=%s", keyName, keyValue)
 	rstSql = fmt.Sprintf("\t\t对应的反向update语句:")
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
-	G_transaction.AppendSQL(&timeSnap, NewShowSql(false, sqlregret+";\n", true))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, sqlregret+";\n", true))
+}
+
+//JSON列的长度, meta为长度字段的字节数
+func readJsonLength(logbuf *mysql.LogBuffer, meta int) int {
+	switch meta {
+	case 1:
+		return logbuf.GetUInt8()
+	case 2:
+		return logbuf.GetUInt16()
+	case 3:
+		return logbuf.GetUInt24()
+	case 4:
+		return int(logbuf.GetUInt32())
+	default:
+		panic(errors.New(fmt.Sprintf("!! Unknown MYSQL_TYPE_JSON packlen = %d", meta)))
+	}
+}
+
+// GEOMETRY输出格式
+const (
+	GEOMETRY_WKT = "wkt" // ST_GeomFromText('POINT(1 2)', srid)
+	GEOMETRY_HEX = "hex" // ST_GeomFromWKB(X'..', srid), 与原值完全一致
+)
+
+//GEOMETRY列转换为构造函数表达式, 生成语句时不加引号
+func (this *LogParser) geometrySql(data []byte) string {
+	//MySQL 8.0中SRID为地理坐标系时按纬度、经度的顺序解析, 而存储的是经度、纬度
+	axisOrder := ""
+	descriptionEvent := this.context.GetFormatDescription()
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) != 0 &&
+		descriptionEvent.GetVersionSum() >= MYSQL_8_0_VERSION && !descriptionEvent.IsMariadb() {
+		axisOrder = ", 'axis-order=long-lat'"
+	}
+
+	if config.G_filterConfig.Geometry != GEOMETRY_HEX {
+		if srid, text, err := mysql.DecodeGeometry(data); nil != err {
+			seelog.Warnf("解析GEOMETRY失败:%s, 按WKB输出", err.Error())
+		} else {
+			return fmt.Sprintf("ST_GeomFromText('%s', %d%s)", text, srid, axisOrder)
+		}
+	}
+
+	if len(data) < 4 {
+		return "NULL"
+	}
+	return fmt.Sprintf("ST_GeomFromWKB(X'%X', %d%s)", data[4:], binary.LittleEndian.Uint32(data), axisOrder)
 }
 
 func (this *LogParser) fetchValue(logbuf *mysql.LogBuffer, columnType byte, meta int, isBinary bool) (interface{}, JavaType, int) {
@@ -1177,6 +1350,21 @@ func (this *LogParser) fetchValue(logbuf *mysql.LogBuffer, columnType byte, meta
 			}
 			typeLen = length + tmpLen
 		}
+	case mysql.MYSQL_TYPE_JSON:
+		{
+			/*
+			 * JSON: 与BLOB相同, meta为长度字段的字节数, 数据为MySQL的二进制JSON格式
+			 */
+			length = readJsonLength(logbuf, meta)
+			if node, err := mysql.ParseJsonBinary(logbuf.GetVarLenBytes(length)); nil != err {
+				seelog.Errorf("解析JSON列失败:%s", err.Error())
+				value = nil
+			} else {
+				value = node
+			}
+			javaType = LONGVARCHAR
+			typeLen = length + meta
+		}
 	case mysql.MYSQL_TYPE_GEOMETRY:
 		{
 			/*
@@ -1195,14 +1383,8 @@ func (this *LogParser) fetchValue(logbuf *mysql.LogBuffer, columnType byte, meta
 			default:
 				panic(errors.New(fmt.Sprintf("!! Unknown MYSQL_TYPE_GEOMETRY packlen = %d", meta)))
 			}
-			/* fill binary */
-
-			bina := make([]byte, 0, length)
-			bina = append(bina, logbuf.GetVarLenBytes(length)...)
-			/* Warning unsupport cloumn type */
-			seelog.Debug("!! Unsupport column type MYSQL_TYPE_GEOMETRY: meta=%d, len = %d", meta, length)
-			javaType = BINARY
-			value = bina
+			value = this.geometrySql(logbuf.GetVarLenBytes(length))
+			javaType = STRUCT
 			typeLen = length + meta
 		}
 	default:
@@ -1222,7 +1404,7 @@ func (this *LogParser) ReadRow(
 	columns []*Column,
 	column_mark []byte,
 	logbuf *mysql.LogBuffer) []*protocol.Column {
-	tableMeta := this.getTableMeta(tableMapEvent.DbName, tableMapEvent.TblName, false)
+	tableMeta := this.getTableMapMeta(tableMapEvent)
 	if nil == tableMeta {
 		err := errors.New("not found [" + tableMapEvent.DbName + "." + tableMapEvent.TblName + "] in db , pls check!")
 		fmt.Println(err.Error())
@@ -1231,88 +1413,135 @@ func (this *LogParser) ReadRow(
 	pro_columns := make([]*protocol.Column, 0, 10)
 
 	for i, c := range columns {
-		column := new(protocol.Column)
-
-		var fieldMeta *FieldMeta = nil
-		var isBinary bool = false
-		if nil != tableMeta {
-			fieldMeta = tableMeta.Fileds[i]
-			column.SetMysqlType(fieldMeta.ColumnType)
-			column.SetName(fieldMeta.ColumnName)
-			column.SetIsKey(fieldMeta.IsThisKey())
-			isBinary = fieldMeta.IsBinary()
-		}
-		column.SetIndex(int32(i))
-
-		if IsNull(column_mark, i) {
-			column.SetIsNull(true)
-			pro_columns = append(pro_columns, column)
-			column.SetSqlType(int32(this.mysqlToJavaType(c.ColumnType, c.ColumnMeta, isBinary)))
-			column.SetValue("")
-			column.SetIsNull(true)
-			// fmt.Printf("空列索引:%d\t空列名称:%s\n", i, fieldMeta.ColumnName)
-			continue
-		} else {
-			column.SetIsNull(false)
-		}
+		column, _ := this.readColumn(tableMapEvent, tableMeta, i, c, IsNull(column_mark, i), isAfter, row, logbuf)
+		pro_columns = append(pro_columns, column)
+	}
+	return pro_columns
+}
 
-		value, javaType, typeLen := this.fetchValue(logbuf, c.ColumnType, c.ColumnMeta, isBinary)
-		column.SetLength(int32(typeLen))
+//读取一列的值, 同时返回解析出的原始值(JSON列为*mysql.JsonNode)
+func (this *LogParser) readColumn(
+	tableMapEvent *TableMapLogEvent,
+	tableMeta *TableMeta,
+	i int,
+	c *Column,
+	isNull bool,
+	isAfter bool,
+	row *protocol.RowData,
+	logbuf *mysql.LogBuffer) (*protocol.Column, interface{}) {
+	column := new(protocol.Column)
+
+	var fieldMeta *FieldMeta = nil
+	var isBinary bool = false
+	if nil != tableMeta {
+		fieldMeta = tableMeta.Fileds[i]
+		column.SetMysqlType(fieldMeta.ColumnType)
+		column.SetName(fieldMeta.ColumnName)
+		column.SetIsKey(fieldMeta.IsThisKey())
+		isBinary = fieldMeta.IsBinary()
+	}
+	column.SetIndex(int32(i))
+
+	if isNull {
+		column.SetIsNull(true)
+		column.SetSqlType(int32(this.mysqlToJavaType(c.ColumnType, c.ColumnMeta, isBinary)))
+		column.SetValue("")
+		column.SetIsNull(true)
+		// fmt.Printf("空列索引:%d\t空列名称:%s\n", i, fieldMeta.ColumnName)
+		return column, nil
+	} else {
+		column.SetIsNull(false)
+	}
 
-		switch javaType {
-		case INTEGER, TINYINT, SMALLINT, BIGINT:
-			{
-				//del with unsigned
-				if nil != fieldMeta && fieldMeta.IsThisUnsigned() && value.(int64) < 0 {
-					column.SetValue("")
-				} else {
-					column.SetValue(strconv.FormatInt(value.(int64), 10))
-				}
+	value, javaType, typeLen := this.fetchValue(logbuf, c.ColumnType, c.ColumnMeta, isBinary)
+	column.SetLength(int32(typeLen))
+
+	switch javaType {
+	case INTEGER, TINYINT, SMALLINT, BIGINT:
+		{
+			//del with unsigned
+			if nil != fieldMeta && fieldMeta.IsThisUnsigned() && value.(int64) < 0 {
+				column.SetValue("")
+			} else {
+				column.SetValue(strconv.FormatInt(value.(int64), 10))
 			}
-		case REAL, DOUBLE, DECIMAL, TIMESTAMP, TIME, DATE, CHAR, VARCHAR:
-			{
-				switch value.(type) {
-				case string:
-					column.SetValue(value.(string))
-				case nil:
-					column.SetValue("")
-				default:
-					column.SetValue("")
-					seelog.Debug("unhandle type")
-				}
+		}
+	case REAL, DOUBLE, DECIMAL, TIMESTAMP, TIME, DATE, CHAR, VARCHAR:
+		{
+			switch value.(type) {
+			case string:
+				column.SetValue(value.(string))
+			case nil:
+				column.SetValue("")
+			default:
+				column.SetValue("")
+				seelog.Debug("unhandle type")
 			}
-		case BIT:
-			{
-				column.SetValue(strconv.FormatInt(value.(int64), 10))
+		}
+	case BIT:
+		{
+			column.SetValue(strconv.FormatInt(value.(int64), 10))
+		}
+	case LONGVARCHAR:
+		{
+			//JSON文本中有引号以及反斜杠, 转义后才能放在生成的语句中
+			if node, ok := value.(*mysql.JsonNode); ok {
+				column.SetValue(mysql.Escape(node.String()))
+			} else {
+				column.SetValue("")
 			}
-		case BINARY, VARBINARY, LONGVARBINARY:
-			{
-				column.SetValue(string(value.([]byte)))
-				if nil != fieldMeta && fieldMeta.IsThisText() {
-					javaType = CLOB
-				} else {
-					javaType = BLOB
-				}
+		}
+	case BINARY, VARBINARY, LONGVARBINARY:
+		{
+			column.SetValue(string(value.([]byte)))
+			if nil != fieldMeta && fieldMeta.IsThisText() {
+				javaType = CLOB
+			} else {
+				javaType = BLOB
 			}
-		default:
-			{
-				switch value.(type) {
-				case string:
-					{
-						column.SetValue(value.(string))
-					}
-				default:
-					column.SetValue("")
+		}
+	default:
+		{
+			switch value.(type) {
+			case string:
+				{
+					column.SetValue(value.(string))
 				}
+			default:
+				column.SetValue("")
+			}
 
+		}
+	}
+	//非UTF-8的字符列转换为UTF-8输出, 不能无损转换时输出为 _字符集 X'原始字节', 保证生成的语句与原值一致
+	if javaType == CHAR || javaType == VARCHAR || javaType == CLOB || javaType == BLOB {
+		if charset := this.columnCharset(tableMapEvent, fieldMeta, i); mysql.NeedDecodeCharset(charset) {
+			if text, ok := mysql.DecodeCharset(charset, []byte(column.GetValue())); ok {
+				column.SetValue(text)
+			} else {
+				column.SetValue(fmt.Sprintf("_%s X'%X'", charset, column.GetValue()))
+				javaType = STRUCT
 			}
 		}
-		column.SetSqlType(int32(javaType))
-		column.SetUpdated(isAfter && this.isUpdate(row.BeforeColumns, column.Value, i))
-		// fmt.Println("column: ", i, column)
-		pro_columns = append(pro_columns, column)
 	}
-	return pro_columns
+
+	column.SetSqlType(int32(javaType))
+	column.SetUpdated(isAfter && this.isUpdate(row.BeforeColumns, column.Value, i))
+	// fmt.Println("column: ", i, column)
+	return column, value
+}
+
+//列的字符集, 优先使用TABLE_MAP_EVENT中记录的字符集, 其次为表结构中的排序规则
+func (this *LogParser) columnCharset(tableMapEvent *TableMapLogEvent, fieldMeta *FieldMeta, i int) string {
+	if nil != tableMapEvent && nil != tableMapEvent.Metadata && i < len(tableMapEvent.Metadata.Charsets) {
+		if charset := mysql.CollationIdCharset(tableMapEvent.Metadata.Charsets[i]); charset != "" {
+			return charset
+		}
+	}
+	if nil != fieldMeta {
+		return mysql.CollationCharset(fieldMeta.Collation)
+	}
+	return ""
 }
 
 func (this *LogParser) isUpdate(beforeColumn []*protocol.Column, newVal *string, index int) bool {
@@ -1343,9 +1572,28 @@ func (this *LogParser) isUpdate(beforeColumn []*protocol.Column, newVal *string,
 }
 
 func (this *LogParser) getTableMeta(dbName string, tableName string, flush bool) *TableMeta {
+	if nil == this.tableMetaCache {
+		return nil
+	}
 	return this.tableMetaCache.getTableMeta(dbName+"."+tableName, flush)
 }
 
+//优先使用TABLE_MAP_EVENT中记录的表结构, 与binlog中的行数据一致且不需要查询数据库
+func (this *LogParser) getTableMapMeta(tableMapEvent *TableMapLogEvent) *TableMeta {
+	tableMeta := tableMapEvent.TableMeta
+	if nil == tableMeta {
+		tableMeta = this.getTableMeta(tableMapEvent.DbName, tableMapEvent.TblName, false)
+	}
+
+	//表结构与binlog中的列数不一致时(如之后增删了列)不能按列名输出
+	if nil != tableMeta && len(tableMeta.Fileds) != tableMapEvent.ColumnCnt {
+		seelog.Warnf("表%s.%s的表结构有%d列, binlog中有%d列, 不使用表结构",
+			tableMapEvent.DbName, tableMapEvent.TblName, len(tableMeta.Fileds), tableMapEvent.ColumnCnt)
+		return nil
+	}
+	return tableMeta
+}
+
 func (this *LogParser) mysqlToJavaType(columnType byte, meta int, isBinary bool) JavaType {
 	var javaType JavaType
 
@@ -1419,6 +1667,8 @@ func (this *LogParser) mysqlToJavaType(columnType byte, meta int, isBinary bool)
 		} else {
 			javaType = CHAR
 		}
+	case mysql.MYSQL_TYPE_JSON:
+		javaType = LONGVARCHAR
 	case mysql.MYSQL_TYPE_GEOMETRY:
 		javaType = BINARY
 	default:
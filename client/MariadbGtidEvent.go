@@ -0,0 +1,64 @@
+package client
+
+import (
+	"strings"
+
+	. "github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/mysql"
+)
+
+func ParseMariadbGtidEvent(logHeader *LogHeader, logBuf *mysql.LogBuffer, descriptionEvent *FormatDescriptionLogEvent) *Mariadb_Gtid_event {
+	this := new(Mariadb_Gtid_event)
+	this.ServerId = uint32(logHeader.GetServerId())
+	this.SeqNo = logBuf.GetUInt64()
+	this.DomainId = logBuf.GetUInt32()
+	this.Flags = logBuf.GetUInt8()
+
+	if this.Flags&FL_GROUP_COMMIT_ID != 0 {
+		this.CommitId = logBuf.GetUInt64()
+	}
+
+	return this
+}
+
+type MariadbGtidListEvent struct {
+	gtids []*Mariadb_Gtid_event
+}
+
+func ParseMariadbGtidListEvent(logBuf *mysql.LogBuffer, descriptionEvent *FormatDescriptionLogEvent) *MariadbGtidListEvent {
+	this := new(MariadbGtidListEvent)
+	//低28位为数量, 高4位为标志
+	count := int(logBuf.GetUInt32() & 0x0fffffff)
+	this.gtids = make([]*Mariadb_Gtid_event, 0, count)
+	for i := 0; i < count; i++ {
+		gtid := new(Mariadb_Gtid_event)
+		gtid.DomainId = logBuf.GetUInt32()
+		gtid.ServerId = logBuf.GetUInt32()
+		gtid.SeqNo = logBuf.GetUInt64()
+		this.gtids = append(this.gtids, gtid)
+	}
+	return this
+}
+
+func (this *MariadbGtidListEvent) String() string {
+	strs := make([]string, 0, len(this.gtids))
+	for _, gtid := range this.gtids {
+		strs = append(strs, gtid.String())
+	}
+	return strings.Join(strs, ",")
+}
+
+// MariaDB的ANNOTATE_ROWS_EVENT 记录了产生行事件的原始语句
+type AnnotateRowsEvent struct {
+	queryString string
+}
+
+func ParseAnnotateRowsEvent(logBuf *mysql.LogBuffer, descriptionEvent *FormatDescriptionLogEvent) *AnnotateRowsEvent {
+	this := new(AnnotateRowsEvent)
+	this.queryString = logBuf.GetRestString()
+	return this
+}
+
+func (this *AnnotateRowsEvent) GetRowsQueryString() string {
+	return this.queryString
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/config"
 	. "github.com/SDHM/sqlregret/mysql"
 	"github.com/cihub/seelog"
 )
@@ -21,8 +23,13 @@ const (
 
 	BINLOG_DUMP_NON_BLOCK           uint16 = 1
 	BINLOG_SEND_ANNOTATE_ROWS_EVENT uint16 = 2
+	BINLOG_THROUGH_GTID             uint16 = 4
 
 	pingPeriod = 10
+
+	//断线重连的间隔, 每次失败后翻倍, 直到最大间隔
+	reconnectInterval    = time.Second
+	reconnectMaxInterval = time.Second * 30
 )
 
 func NewNetBinlogReader(
@@ -65,8 +72,38 @@ type NetBinlogReader struct {
 	collation     CollationId
 	charset       string
 	salt          []byte
+	serverVersion string
+	authPlugin    string
 	lastPing      int64
 	pkgErr        error
+	committedFile string   // 最后一个完整事务所在的文件
+	committedPos  int64    // 最后一个完整事务结束的位置
+	committedGtid *GtidSet // 按GTID dump时已经处理完的GTID集合
+	heartbeat     time.Duration
+	readTimeout   time.Duration
+	tlsMode       string
+	tlsConfig     *tls.Config
+	archiver      *BinlogArchiver // 不为空时把事件原样保存到本地文件
+	eventCount    int64           // 读取的事件数
+	lastPos       int64           // 最后一个事件结束的位置
+	inTransaction bool            // 是否在BEGIN与XID/COMMIT之间
+}
+
+//设置archive模式, 事件不再解析, 原样保存到本地
+func (this *NetBinlogReader) SetArchiver(archiver *BinlogArchiver) {
+	this.archiver = archiver
+}
+
+//设置TLS, mode为disabled、preferred、required
+func (this *NetBinlogReader) SetTLS(mode string, tlsConfig *tls.Config) {
+	this.tlsMode = mode
+	this.tlsConfig = tlsConfig
+}
+
+//设置心跳间隔以及读超时时间, 超时没有收到事件或心跳则认为连接已经断开
+func (this *NetBinlogReader) SetHeartbeat(heartbeat, readTimeout time.Duration) {
+	this.heartbeat = heartbeat
+	this.readTimeout = readTimeout
 }
 
 func (this *NetBinlogReader) Connect() error {
@@ -98,13 +135,19 @@ func (this *NetBinlogReader) ReConnect() error {
 		return err
 	}
 
+	if err := this.upgradeTLS(); err != nil {
+		this.conn.Close()
+		seelog.Error(err.Error())
+		return err
+	}
+
 	if err := this.writeAuthHandshake(); err != nil {
 		this.conn.Close()
 		seelog.Error(err.Error())
 		return err
 	}
 
-	if _, err := this.readOK(); err != nil {
+	if err := this.handleAuthResult(); err != nil {
 		this.conn.Close()
 		seelog.Error(err.Error())
 		return err
@@ -137,6 +180,16 @@ func (this *NetBinlogReader) Register() error {
 
 	this.Execute(`set @master_binlog_checksum= '@@global.binlog_checksum'`)
 
+	//告诉MariaDB我们能处理GTID等事件, 否则master会把它们替换成其它事件
+	if this.IsMariadb() {
+		this.Execute(`set @mariadb_slave_capability=4`)
+	}
+
+	//master空闲时按此间隔发送心跳, 单位为纳秒
+	if this.heartbeat > 0 {
+		this.Execute(fmt.Sprintf("set @master_heartbeat_period=%d", this.heartbeat.Nanoseconds()))
+	}
+
 	this.pkg.Sequence = 0
 
 	data := make([]byte, 4, 18+len(this.self_name)+len(this.self_user)+len(this.self_password))
@@ -170,13 +223,44 @@ func (this *NetBinlogReader) Register() error {
 }
 
 func (this *NetBinlogReader) Dump(position uint32, filename string) error {
+	this.committedFile = filename
+	this.committedPos = int64(position)
+	this.committedGtid = nil
+
+	if err := this.writeDump(position, filename); err != nil {
+		return err
+	}
+
+	return this.ParseBinlog()
+}
+
+//按GTID集合Dump日志, 从集合之后的第一个事务开始
+func (this *NetBinlogReader) DumpGtid(gtidSet *GtidSet) error {
+	this.committedGtid = gtidSet.Clone()
+
+	if err := this.writeDumpGtid(gtidSet); err != nil {
+		return err
+	}
+
+	return this.ParseBinlog()
+}
+
+func (this *NetBinlogReader) writeDump(position uint32, filename string) error {
 	this.pkg.Sequence = 0
 
 	data := make([]byte, 4, 11+len(filename))
 
+	var flags uint16 = 0
+	if this.IsMariadb() && config.G_filterConfig.Origin {
+		flags |= BINLOG_SEND_ANNOTATE_ROWS_EVENT
+	}
+	if config.G_filterConfig.NonBlock {
+		flags |= BINLOG_DUMP_NON_BLOCK
+	}
+
 	data = append(data, COM_BINLOG_DUMP)
 	data = append(data, Uint32ToBytes(position)...)
-	data = append(data, Uint16ToBytes(uint16(0))...)
+	data = append(data, Uint16ToBytes(flags)...)
 	data = append(data, Uint32ToBytes(this.self_slaveId)...)
 	data = append(data, []byte(filename)...)
 
@@ -185,39 +269,309 @@ func (this *NetBinlogReader) Dump(position uint32, filename string) error {
 		return err
 	}
 	this.binlogFileName = filename
-	this.ParseBinlog()
 
 	return nil
 }
 
+func (this *NetBinlogReader) writeDumpGtid(gtidSet *GtidSet) error {
+	this.pkg.Sequence = 0
+
+	gtidData := gtidSet.Encode()
+	data := make([]byte, 4, 4+1+2+4+4+8+4+len(gtidData))
+
+	flags := BINLOG_THROUGH_GTID
+	if config.G_filterConfig.NonBlock {
+		flags |= BINLOG_DUMP_NON_BLOCK
+	}
+
+	data = append(data, COM_BINLOG_DUMP_GTID)
+	data = append(data, Uint16ToBytes(flags)...)
+	data = append(data, Uint32ToBytes(this.self_slaveId)...)
+	//binlog文件名为空, 由master根据GTID集合定位
+	data = append(data, Uint32ToBytes(0)...)
+	data = append(data, Uint64ToBytes(4)...)
+	data = append(data, Uint32ToBytes(uint32(len(gtidData)))...)
+	data = append(data, gtidData...)
+
+	if err := this.writePacket(data); err != nil {
+		seelog.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+//列出master上的binlog文件, 按先后顺序
+func (this *NetBinlogReader) ListBinlogFiles(startFile string) ([]string, error) {
+	if err := this.ReConnect(); err != nil {
+		return nil, err
+	}
+	defer this.Close()
+
+	result, err := this.Query("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, result.RowNumber())
+	for i := 0; i < result.RowNumber(); i++ {
+		fileName, err := result.GetStringByName(i, "Log_name")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fileName)
+	}
+	return files, nil
+}
+
+//读取binlog文件第一个事件的时间, 以非阻塞方式dump该文件, 读到第一个事件后断开
+func (this *NetBinlogReader) GetFirstEventTime(fileName string) (time.Time, error) {
+	if err := this.ReConnect(); err != nil {
+		return time.Time{}, err
+	}
+	defer this.Close()
+
+	if err := this.Register(); err != nil {
+		return time.Time{}, err
+	}
+
+	this.pkg.Sequence = 0
+	data := make([]byte, 4, 15+len(fileName))
+	data = append(data, COM_BINLOG_DUMP)
+	data = append(data, Uint32ToBytes(4)...)
+	data = append(data, Uint16ToBytes(BINLOG_DUMP_NON_BLOCK)...)
+	data = append(data, Uint32ToBytes(this.self_slaveId)...)
+	data = append(data, []byte(fileName)...)
+
+	if err := this.writePacket(data); err != nil {
+		return time.Time{}, err
+	}
+
+	for {
+		by, err := this.readPacket()
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if by[0] == ERR_HEADER {
+			return time.Time{}, this.handleErrorPacket(by)
+		}
+
+		if this.isEOFPacket(by) {
+			return time.Time{}, fmt.Errorf("binlog文件%s中没有事件", fileName)
+		}
+
+		//跳过master伪造的ROTATE_EVENT
+		header := this.ReadEventHeader(NewLogBuffer(by[1:20]))
+		if header.GetLogPos() != 0 {
+			return time.Unix(header.timeSnamp, 0), nil
+		}
+	}
+}
+
 func (this *NetBinlogReader) ParseBinlog() error {
 	for {
-		if by, err := this.ReadPacket(0); err != nil {
-			seelog.Error(err.Error())
-			return err
-		} else {
-			header := this.ReadEventHeader(NewLogBuffer(by[1:20]))
+		if this.readTimeout > 0 {
+			this.conn.SetReadDeadline(time.Now().Add(this.readTimeout))
+		}
 
-			timeSnap := time.Unix(header.timeSnamp, 0)
-			if FilterTime(timeSnap, header.GetEventType()) {
-				continue
+		by, err := this.ReadPacket(0)
+		if err != nil {
+			seelog.Error(err.Error())
+			if err != ErrBadConn {
+				return err
 			}
 
-			if FilterMode(header.GetEventType()) {
-				this.StoreTimePos(timeSnap, this.binlogFileName, header.GetLogPos())
-				continue
+			//连接断开或超时, 重连后从最后一个完整事务之后继续
+			if err = this.resume(); err != nil {
+				return err
 			}
+			continue
+		}
 
-			if FilterPos(header.GetEventType(), this.fileIndex, header.GetLogPos()) {
-				continue
-			}
+		if by[0] == ERR_HEADER {
+			err = this.handleErrorPacket(by)
+			seelog.Error(err.Error())
+			return err
+		}
+
+		//非阻塞dump时读到master当前的末尾会收到EOF包
+		if this.isEOFPacket(by) {
+			this.finish()
+			return nil
+		}
+
+		if err := this.handlePacket(by); err != nil {
+			return err
+		}
+	}
+}
+
+//处理一个事件包, 完整的事务结束后记录继续的位置
+func (this *NetBinlogReader) handlePacket(by []byte) error {
+	header := this.ReadEventHeader(NewLogBuffer(by[1:20]))
+	if eventType := header.GetEventType(); eventType == binlogevent.HEARTBEAT_LOG_EVENT || eventType == binlogevent.HEARTBEAT_LOG_EVENT_V2 {
+		//心跳只用来刷新读超时
+		return nil
+	}
 
-			if FilterSkipSQL(header.GetEventType()) {
-				continue
+	this.eventCount++
+	if header.GetLogPos() != 0 {
+		this.lastPos = header.GetLogPos()
+	}
+
+	if skip, err := this.VerifyEvent(header, by[1:20], by[20:]); err != nil {
+		return err
+	} else if skip {
+		return nil
+	}
+
+	if nil != this.archiver {
+		return this.archiveEvent(header, by)
+	}
+
+	sid, gno := this.GetTransaction().GetGtidNo()
+	this.handleEvent(header, by)
+
+	switch header.GetEventType() {
+	case XID_EVENT:
+		this.inTransaction = false
+		this.commit(sid, gno, header.GetLogPos())
+	case QUERY_EVENT:
+		if this.isTransactionEnd(this.queryOf(by)) {
+			this.commit(sid, gno, header.GetLogPos())
+		}
+	case GTID_EVENT:
+		//MariaDB的GTID事件代替了BEGIN, 单独的DDL带有standalone标记
+		gtidEvent := ParseMariadbGtidEvent(header, NewLogBuffer(this.eventBody(by)), this.context.GetFormatDescription())
+		this.inTransaction = !gtidEvent.IsStandalone()
+	}
+	return nil
+}
+
+//QUERY_EVENT是否结束了一个事务: BEGIN…COMMIT中的COMMIT, 或者不在事务中的语句(如DDL)
+func (this *NetBinlogReader) isTransactionEnd(query string) bool {
+	switch strings.ToLower(strings.TrimSpace(query)) {
+	case "begin":
+		this.inTransaction = true
+		return false
+	case "commit", "rollback":
+		this.inTransaction = false
+		return true
+	default:
+		return !this.inTransaction
+	}
+}
+
+func (this *NetBinlogReader) queryOf(by []byte) string {
+	return ParseQueryLogEvent(NewLogBuffer(this.eventBody(by)), this.context.GetFormatDescription()).GetQuery()
+}
+
+//事件体, 去掉末尾的CRC32校验值
+func (this *NetBinlogReader) eventBody(by []byte) []byte {
+	if this.context.formatDescription.GetChecksumAlg() == binlogevent.BINLOG_CHECKSUM_ALG_CRC32 && len(by) >= 24 {
+		return by[20 : len(by)-4]
+	}
+	return by[20:]
+}
+
+func (this *NetBinlogReader) handleEvent(header *LogHeader, by []byte) {
+	timeSnap := time.Unix(header.timeSnamp, 0)
+	if FilterTime(timeSnap, header.GetEventType()) {
+		return
+	}
+
+	if FilterMode(header.GetEventType()) {
+		this.StoreTimePos(timeSnap, this.binlogFileName, header.GetLogPos())
+		this.markTimePos(header.GetEventType(), timeSnap, header.GetLogPos())
+		return
+	}
+
+	if FilterPos(header.GetEventType(), this.fileIndex, header.GetLogPos()) {
+		return
+	}
+
+	if FilterSkipSQL(header.GetEventType(), this.GetTransaction()) {
+		return
+	}
+	// sss := fmt.Sprintf("时间:%s\t文件名:%s\t位置:%d", timeSnap.Format("2006-01-02 15:04:05"), this.binlogFileName, header.GetLogPos())
+	// fmt.Println("str:", sss)
+	this.ParseLog(header, by[0:])
+}
+
+//读取结束, 输出最后一个事务以及统计信息
+func (this *NetBinlogReader) finish() {
+	this.GetTransaction().Flush()
+	fmt.Printf("已读取到master当前末尾 文件:%s\t位置:%d\t事件数:%d\n", this.binlogFileName, this.lastPos, this.eventCount)
+}
+
+//保存事件, 位置为0的事件(如开始dump时的ROTATE)不在master的binlog文件中
+func (this *NetBinlogReader) archiveEvent(header *LogHeader, by []byte) error {
+	if header.GetLogPos() != 0 {
+		if err := this.archiver.Write(by[1:]); err != nil {
+			return err
+		}
+		this.commit(nil, 0, header.GetLogPos())
+		this.StoreTimePos(time.Unix(header.timeSnamp, 0), this.binlogFileName, header.GetLogPos())
+	}
+
+	//需要解析FORMAT_DESCRIPTION_EVENT获取校验算法, ROTATE_EVENT切换文件
+	eventType := header.GetEventType()
+	if eventType == FORMAT_DESCRIPTION_EVENT || eventType == ROTATE_EVENT {
+		this.ParseLog(header, by)
+		if this.archiver.GetFileName() != this.binlogFileName {
+			return fmt.Errorf("无法保存binlog文件:%s", this.binlogFileName)
+		}
+	}
+
+	return nil
+}
+
+//记录最后一个完整事务结束的位置
+func (this *NetBinlogReader) commit(sid []byte, gno int64, pos int64) {
+	this.committedFile = this.binlogFileName
+	this.committedPos = pos
+	if nil != this.committedGtid && nil != sid && gno > 0 {
+		this.committedGtid.AddGtid(sid, gno)
+	}
+}
+
+//断线重连, 重新注册并从最后一个完整事务之后继续dump
+func (this *NetBinlogReader) resume() error {
+	this.GetTransaction().Discard()
+	this.inTransaction = false
+
+	interval := reconnectInterval
+	for {
+		seelog.Warnf("连接断开, %v后重连, 继续位置 文件:%s\t位置:%d", interval, this.committedFile, this.committedPos)
+		time.Sleep(interval)
+
+		err := this.ReConnect()
+		if err == nil {
+			err = this.Register()
+		}
+
+		if err == nil {
+			if nil != this.committedGtid {
+				err = this.writeDumpGtid(this.committedGtid)
+			} else {
+				err = this.writeDump(uint32(this.committedPos), this.committedFile)
 			}
-			// sss := fmt.Sprintf("时间:%s\t文件名:%s\t位置:%d", timeSnap.Format("2006-01-02 15:04:05"), this.binlogFileName, header.GetLogPos())
-			// fmt.Println("str:", sss)
-			this.ParseLog(header, by[0:])
+		}
+
+		if err == nil {
+			seelog.Info("重连成功")
+			return nil
+		}
+
+		//服务端明确拒绝(如账号无权限、日志已被清除)时不再重试
+		if _, ok := err.(*SqlError); ok {
+			return err
+		}
+
+		interval *= 2
+		if interval > reconnectMaxInterval {
+			interval = reconnectMaxInterval
 		}
 	}
 }
@@ -234,6 +588,9 @@ func (this *NetBinlogReader) ParseLog(header *LogHeader, by []byte) {
 			} else {
 				// time.Sleep(time.Millisecond * 200)
 			}
+		} else if header.GetEventType() == ROTATE_EVENT && checkEventCRC32(by[1:20], by[20:]) {
+			//开始dump时的ROTATE在FORMAT_DESCRIPTION_EVENT之前, 此时还不知道校验算法
+			this.Parse(header, NewLogBuffer(by[20:len(by)-4]), this.SwitchLogFile)
 		} else {
 			// fmt.Printf("notcrc eventLen:%d\t checksumalg:%d\n", header.GetEventLen(), this.context.formatDescription.GetChecksumAlg())
 			this.Parse(header, NewLogBuffer(by[20:]), this.SwitchLogFile)
@@ -241,8 +598,8 @@ func (this *NetBinlogReader) ParseLog(header *LogHeader, by []byte) {
 	}
 }
 func (this *NetBinlogReader) StoreTimePos(t time.Time, fileName string, pos int64) {
-	//十秒钟一个记录
-	if t.Sub(lastLogTime) >= time.Second*10 {
+	//按--mark-interval的间隔记录
+	if t.Sub(lastLogTime) >= time.Duration(config.G_filterConfig.MarkInterval)*time.Second {
 		str := fmt.Sprintf("时间:%s\t文件名:%s\t位置:%d", t.Format("2006-01-02 15:04:05"), fileName, pos)
 		fmt.Println(str)
 		lastLogTime = t
@@ -262,8 +619,15 @@ func (this *NetBinlogReader) ReadPacket(eventLen int64) ([]byte, error) {
 //切换日志文件
 func (this *NetBinlogReader) SwitchLogFile(fileName string, pos int64) error {
 	this.binlogFileName = fileName
-	fileIndex, _ := strconv.Atoi(strings.Split(fileName, ".")[1])
+	fileIndex, _ := BinlogFileIndex(fileName)
 	this.fileIndex = fileIndex
+
+	if nil != this.archiver {
+		if err := this.archiver.Open(fileName, pos); err != nil {
+			seelog.Error("打开本地binlog文件失败:", err.Error())
+			return err
+		}
+	}
 	return nil
 }
 
@@ -296,10 +660,16 @@ func (this *NetBinlogReader) readInitialHandshake() error {
 		return errors.New("invalid protocol version must >= 10")
 	}
 
-	//skip mysql version and connection id
+	//重连时重新读取salt
+	this.salt = nil
+
 	//mysql version end with 0x00
+	versionLen := bytes.IndexByte(data[1:], 0x00)
+	this.serverVersion = string(data[1 : 1+versionLen])
+
+	//skip mysql version and connection id
 	//connection id length is 4
-	pos := 1 + bytes.IndexByte(data[1:], 0x00) + 1 + 4
+	pos := 1 + versionLen + 1 + 4
 
 	this.salt = append(this.salt, data[pos:pos+8]...)
 
@@ -332,17 +702,238 @@ func (this *NetBinlogReader) readInitialHandshake() error {
 		// mysql-proxy also use 12
 		// which is not documented but seems to work.
 		this.salt = append(this.salt, data[pos:pos+12]...)
+		pos += 13
+
+		//auth plugin name end with 0x00
+		if this.capability&CLIENT_PLUGIN_AUTH > 0 && len(data) > pos {
+			if end := bytes.IndexByte(data[pos:], 0x00); end != -1 {
+				this.authPlugin = string(data[pos : pos+end])
+			} else {
+				this.authPlugin = string(data[pos:])
+			}
+		}
+	}
+
+	if this.authPlugin == "" {
+		this.authPlugin = AUTH_NAME
 	}
 
 	return nil
 }
 
-func (this *NetBinlogReader) writeAuthHandshake() error {
+//按认证插件计算认证数据
+func (this *NetBinlogReader) calcAuthResponse() ([]byte, error) {
+	switch this.authPlugin {
+	case AUTH_NAME:
+		return CalcPassword(this.scramble(), []byte(this.password)), nil
+	case AUTH_CACHING_SHA2_PASSWORD:
+		return CalcCachingSha2Password(this.scramble(), []byte(this.password)), nil
+	case AUTH_SHA256_PASSWORD:
+		if len(this.password) == 0 {
+			return []byte{0}, nil
+		}
+		if this.isSecureConn() {
+			return append([]byte(this.password), 0), nil
+		}
+		//向服务端请求公钥
+		return []byte{1}, nil
+	case AUTH_CLEAR_PASSWORD:
+		if !this.isSecureConn() {
+			return nil, fmt.Errorf("认证插件%s只能在加密连接下使用", this.authPlugin)
+		}
+		return append([]byte(this.password), 0), nil
+	default:
+		return nil, fmt.Errorf("不支持的认证插件:%s", this.authPlugin)
+	}
+}
+
+//scramble固定为20字节, 握手包中的salt可能带有结尾的0x00
+func (this *NetBinlogReader) scramble() []byte {
+	if len(this.salt) > 20 {
+		return this.salt[:20]
+	}
+	return this.salt
+}
+
+//unix socket或TLS连接上可以直接发送明文密码
+func (this *NetBinlogReader) isSecureConn() bool {
+	if _, ok := this.conn.(*net.UnixConn); ok {
+		return true
+	}
+	_, ok := this.conn.(*tls.Conn)
+	return ok
+}
+
+//认证阶段的数据包, 序号紧接着上一个包
+func (this *NetBinlogReader) writeAuthData(auth []byte) error {
+	data := make([]byte, 4, 4+len(auth))
+	data = append(data, auth...)
+	return this.writePacket(data)
+}
+
+//处理认证结果, 包括切换认证插件以及caching_sha2_password的完整认证
+func (this *NetBinlogReader) handleAuthResult() error {
+	data, err := this.readPacket()
+	if err != nil {
+		seelog.Error(err.Error())
+		return err
+	}
+
+	switch data[0] {
+	case OK_HEADER:
+		_, err = this.handleOKPacket(data)
+		return err
+	case ERR_HEADER:
+		return this.handleErrorPacket(data)
+	case AUTH_SWITCH_HEADER:
+		//AuthSwitchRequest: 插件名(0结尾) + 新的scramble
+		pluginEnd := bytes.IndexByte(data[1:], 0x00)
+		if pluginEnd == -1 {
+			return ErrMalformPacket
+		}
+		this.authPlugin = string(data[1 : 1+pluginEnd])
+		this.salt = append([]byte{}, bytes.TrimRight(data[2+pluginEnd:], "\x00")...)
+		seelog.Debugf("切换认证插件:%s", this.authPlugin)
+
+		auth, err := this.calcAuthResponse()
+		if err != nil {
+			return err
+		}
+		if err = this.writeAuthData(auth); err != nil {
+			return err
+		}
+		return this.handleAuthResult()
+	case AUTH_MORE_DATA_HEADER:
+		return this.handleAuthMoreData(data[1:])
+	default:
+		return errors.New("invalid auth packet")
+	}
+}
+
+func (this *NetBinlogReader) handleAuthMoreData(data []byte) error {
+	if this.authPlugin == AUTH_SHA256_PASSWORD {
+		//sha256_password 服务端直接返回公钥
+		if err := this.sendEncryptedPassword(data); err != nil {
+			return err
+		}
+		return this.handleAuthResult()
+	}
+
+	if this.authPlugin != AUTH_CACHING_SHA2_PASSWORD || len(data) == 0 {
+		return errors.New("invalid auth more data packet")
+	}
+
+	switch data[0] {
+	case CACHING_SHA2_FAST_AUTH_SUCCESS:
+		//缓存命中, 接下来是OK包
+		return this.handleAuthResult()
+	case CACHING_SHA2_PERFORM_FULL_AUTH:
+		if this.isSecureConn() {
+			if err := this.writeAuthData(append([]byte(this.password), 0)); err != nil {
+				return err
+			}
+			return this.handleAuthResult()
+		}
+
+		//请求服务端的RSA公钥
+		if err := this.writeAuthData([]byte{CACHING_SHA2_REQUEST_PUBLIC_KEY}); err != nil {
+			return err
+		}
+
+		pubKey, err := this.readPacket()
+		if err != nil {
+			return err
+		}
+		if pubKey[0] == ERR_HEADER {
+			return this.handleErrorPacket(pubKey)
+		}
+		if pubKey[0] != AUTH_MORE_DATA_HEADER {
+			return errors.New("invalid public key packet")
+		}
+
+		if err = this.sendEncryptedPassword(pubKey[1:]); err != nil {
+			return err
+		}
+		return this.handleAuthResult()
+	default:
+		return errors.New("invalid auth more data packet")
+	}
+}
+
+func (this *NetBinlogReader) sendEncryptedPassword(pemData []byte) error {
+	pub, err := ParsePublicKey(pemData)
+	if err != nil {
+		return err
+	}
+
+	enc, err := EncryptPassword(this.scramble(), []byte(this.password), pub)
+	if err != nil {
+		return err
+	}
+	return this.writeAuthData(enc)
+}
+
+func (this *NetBinlogReader) useTLS() bool {
+	return this.tlsMode == config.TLS_MODE_REQUIRED || this.tlsMode == config.TLS_MODE_PREFERRED
+}
+
+func (this *NetBinlogReader) clientCapability() uint32 {
 	// Adjust client capability flags based on server support
 	capability := CLIENT_PROTOCOL_41 | CLIENT_SECURE_CONNECTION |
-		CLIENT_LONG_PASSWORD | CLIENT_TRANSACTIONS | CLIENT_LONG_FLAG | CLIENT_MULTI_RESULTS
+		CLIENT_LONG_PASSWORD | CLIENT_TRANSACTIONS | CLIENT_LONG_FLAG | CLIENT_MULTI_RESULTS |
+		CLIENT_PLUGIN_AUTH
+
+	if this.useTLS() {
+		capability |= CLIENT_SSL
+	}
+
+	return capability & this.capability
+}
+
+//发送SSLRequest并把连接升级为TLS
+func (this *NetBinlogReader) upgradeTLS() error {
+	if !this.useTLS() {
+		return nil
+	}
+
+	if this.capability&CLIENT_SSL == 0 {
+		if this.tlsMode == config.TLS_MODE_REQUIRED {
+			return errors.New("服务端不支持TLS连接")
+		}
+		seelog.Warn("服务端不支持TLS连接, 使用非加密连接")
+		return nil
+	}
+
+	//SSLRequest: capability 4, max-packet size 4, charset 1, reserved 23
+	data := make([]byte, 4+4+4+1+23)
+	capability := this.clientCapability()
+	data[4] = byte(capability)
+	data[5] = byte(capability >> 8)
+	data[6] = byte(capability >> 16)
+	data[7] = byte(capability >> 24)
+	data[12] = byte(this.collation)
 
-	capability &= this.capability
+	if err := this.writePacket(data); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(this.conn, this.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	//后续的认证包序号紧接着SSLRequest
+	sequence := this.pkg.Sequence
+	this.conn = tlsConn
+	this.pkg = NewPacketIO(tlsConn, tlsConn)
+	this.pkg.Sequence = sequence
+	seelog.Debug("已建立TLS连接")
+
+	return nil
+}
+
+func (this *NetBinlogReader) writeAuthHandshake() error {
+	capability := this.clientCapability()
 
 	//packet length
 	//capbility 4
@@ -355,7 +946,10 @@ func (this *NetBinlogReader) writeAuthHandshake() error {
 	length += len(this.user) + 1
 
 	//we only support secure connection
-	auth := CalcPassword(this.salt, []byte(this.password))
+	auth, err := this.calcAuthResponse()
+	if err != nil {
+		return err
+	}
 
 	length += 1 + len(auth)
 
@@ -365,6 +959,11 @@ func (this *NetBinlogReader) writeAuthHandshake() error {
 		length += len(this.db) + 1
 	}
 
+	//auth plugin name [null terminated string]
+	if capability&CLIENT_PLUGIN_AUTH > 0 {
+		length += len(this.authPlugin) + 1
+	}
+
 	this.capability = capability
 
 	data := make([]byte, length+4)
@@ -402,6 +1001,13 @@ func (this *NetBinlogReader) writeAuthHandshake() error {
 	if len(this.db) > 0 {
 		pos += copy(data[pos:], this.db)
 		//data[pos] = 0x00
+		pos++
+	}
+
+	// auth plugin name [null terminated string]
+	if capability&CLIENT_PLUGIN_AUTH > 0 {
+		pos += copy(data[pos:], this.authPlugin)
+		//data[pos] = 0x00
 	}
 
 	return this.writePacket(data)
@@ -842,6 +1448,10 @@ func (this *NetBinlogReader) IsInTransaction() bool {
 	return this.status&SERVER_STATUS_IN_TRANS > 0
 }
 
+func (this *NetBinlogReader) IsMariadb() bool {
+	return strings.Contains(this.serverVersion, "MariaDB")
+}
+
 func (this *NetBinlogReader) GetCharset() string {
 	return this.charset
 }
@@ -0,0 +1,300 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/config"
+	. "github.com/SDHM/sqlregret/mysql"
+)
+
+// 模拟支持TLS的mysql服务端, 只处理握手与认证
+type standInServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config // 为nil时不支持TLS
+	password  string
+	salt      []byte
+	errs      chan error
+}
+
+func newStandInServer(t *testing.T, tlsConfig *tls.Config, password string) *standInServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	this := &standInServer{
+		listener:  listener,
+		tlsConfig: tlsConfig,
+		password:  password,
+		salt:      []byte("0123456789abcdefghij"),
+		errs:      make(chan error, 1),
+	}
+	go func() {
+		this.errs <- this.serve()
+	}()
+	return this
+}
+
+func (this *standInServer) port() uint16 {
+	return uint16(this.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (this *standInServer) serve() error {
+	conn, err := this.listener.Accept()
+	if nil != err {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	capability := CLIENT_PROTOCOL_41 | CLIENT_SECURE_CONNECTION | CLIENT_LONG_PASSWORD |
+		CLIENT_TRANSACTIONS | CLIENT_LONG_FLAG | CLIENT_PLUGIN_AUTH
+	if nil != this.tlsConfig {
+		capability |= CLIENT_SSL
+	}
+
+	data := make([]byte, 4, 128)
+	data = append(data, MinProtocolVersion)
+	data = append(data, "5.7.99-standin"...)
+	data = append(data, 0)
+	data = append(data, Uint32ToBytes(1)...)
+	data = append(data, this.salt[:8]...)
+	data = append(data, 0)
+	data = append(data, Uint16ToBytes(uint16(capability))...)
+	data = append(data, byte(DEFAULT_COLLATION_ID))
+	data = append(data, Uint16ToBytes(SERVER_STATUS_AUTOCOMMIT)...)
+	data = append(data, Uint16ToBytes(uint16(capability>>16))...)
+	data = append(data, byte(len(this.salt)+1))
+	data = append(data, make([]byte, 10)...)
+	data = append(data, this.salt[8:]...)
+	data = append(data, 0)
+	data = append(data, AUTH_NAME...)
+	data = append(data, 0)
+
+	//PacketIO的读缓冲会吞掉TLS握手的数据, 服务端直接读取数据包
+	pkg := NewPacketIO(conn, conn)
+	if err := pkg.WritePacket(data); nil != err {
+		return err
+	}
+
+	resp, err := readRawPacket(conn)
+	if nil != err {
+		return err
+	}
+
+	//握手包序号为0, 认证包为1, 使用TLS时认证包在SSLRequest之后为2
+	pkg.Sequence = 2
+	clientCapability := uint32(resp[0]) | uint32(resp[1])<<8 | uint32(resp[2])<<16 | uint32(resp[3])<<24
+	if clientCapability&CLIENT_SSL > 0 {
+		if nil == this.tlsConfig || len(resp) != 32 {
+			return errors.New("unexpected ssl request")
+		}
+
+		tlsConn := tls.Server(conn, this.tlsConfig)
+		if err := tlsConn.Handshake(); nil != err {
+			return err
+		}
+
+		pkg = NewPacketIO(tlsConn, tlsConn)
+		pkg.Sequence = 3
+		if resp, err = readRawPacket(tlsConn); nil != err {
+			return err
+		}
+	}
+
+	//跳过capability、max-packet size、charset、reserved以及用户名
+	pos := 4 + 4 + 1 + 23
+	pos += bytes.IndexByte(resp[pos:], 0) + 1
+	auth := resp[pos+1 : pos+1+int(resp[pos])]
+
+	if !bytes.Equal(auth, CalcPassword(this.salt, []byte(this.password))) {
+		return pkg.WritePacket(append(make([]byte, 4), ERR_HEADER, 0x15, 0x04, '#', '2', '8', '0', '0', '0'))
+	}
+
+	ok := append(make([]byte, 4), OK_HEADER, 0, 0)
+	ok = append(ok, Uint16ToBytes(SERVER_STATUS_AUTOCOMMIT)...)
+	ok = append(ok, 0, 0)
+	return pkg.WritePacket(ok)
+}
+
+func readRawPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); nil != err {
+		return nil, err
+	}
+
+	data := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	if _, err := io.ReadFull(r, data); nil != err {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 生成自签名证书, 同时作为CA
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sqlregret test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestConnectTLS(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	server := newStandInServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, "123456")
+	defer server.listener.Close()
+
+	reader := NewNetBinlogReader("127.0.0.1", "reader", "123456", "", server.port(), 5)
+	reader.SetTLS(config.TLS_MODE_REQUIRED, &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	if err := reader.Connect(); nil != err {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if _, ok := reader.conn.(*tls.Conn); !ok {
+		t.Fatal("connection should be tls")
+	}
+	if err := <-server.errs; nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectTLSVerifyFailed(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	server := newStandInServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, "123456")
+	defer server.listener.Close()
+
+	reader := NewNetBinlogReader("127.0.0.1", "reader", "123456", "", server.port(), 5)
+	reader.SetTLS(config.TLS_MODE_REQUIRED, &tls.Config{RootCAs: pool, ServerName: "db.example.com"})
+	if err := reader.Connect(); nil == err {
+		reader.Close()
+		t.Fatal("server name should not match")
+	}
+}
+
+func TestConnectWithoutServerTLS(t *testing.T) {
+	server := newStandInServer(t, nil, "123456")
+	defer server.listener.Close()
+
+	reader := NewNetBinlogReader("127.0.0.1", "reader", "123456", "", server.port(), 5)
+	reader.SetTLS(config.TLS_MODE_REQUIRED, &tls.Config{InsecureSkipVerify: true})
+	if err := reader.Connect(); nil == err {
+		reader.Close()
+		t.Fatal("required mode should fail without server tls")
+	}
+
+	server = newStandInServer(t, nil, "123456")
+	defer server.listener.Close()
+
+	reader = NewNetBinlogReader("127.0.0.1", "reader", "123456", "", server.port(), 5)
+	reader.SetTLS(config.TLS_MODE_PREFERRED, &tls.Config{InsecureSkipVerify: true})
+	if err := reader.Connect(); nil != err {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if _, ok := reader.conn.(*tls.Conn); ok {
+		t.Fatal("connection should be plain")
+	}
+	if err := <-server.errs; nil != err {
+		t.Fatal(err)
+	}
+}
+
+// 按事件顺序构造dump收到的数据包, 第一个事件从位置4开始
+func newTestDumpPackets(events ...[]byte) [][]byte {
+	packets := make([][]byte, 0, len(events))
+	pos := 4
+	for _, event := range events {
+		packet := append([]byte{OK_HEADER}, newTestEvent(event[0], pos, event[1:])...)
+		pos += len(packet) - 1
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+func newTestGtidEvent(sid []byte, gno int64) []byte {
+	event := append([]byte{binlogevent.GTID_LOG_EVENT, 0}, sid...)
+	return append(event, Uint64ToBytes(uint64(gno))...)
+}
+
+func TestResumeAfterDDL(t *testing.T) {
+	G_transaction = NewBufferTransaction(&bytes.Buffer{}, &bytes.Buffer{})
+	sid, _ := ParseSID("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+
+	//GTID模式: DDL之后的未完成事务不计入
+	packets := newTestDumpPackets(
+		newTestGtidEvent(sid, 2), newTestQueryEvent("test", "create table t1 (id int)"),
+		newTestGtidEvent(sid, 3), newTestQueryEvent("test", "BEGIN"))
+	gtidSet, _ := ParseGtidSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1")
+	reader := NewNetBinlogReader("127.0.0.1", "reader", "123456", "", 3306, 5)
+	reader.committedGtid = gtidSet
+	for _, packet := range packets {
+		if err := reader.handlePacket(packet); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if got := reader.committedGtid.String(); got != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-2" {
+		t.Fatalf("got gtid set %s", got)
+	}
+
+	//位置模式: 非事务表的BEGIN…COMMIT以及XID之后的DDL都是完整事务的结束
+	packets = newTestDumpPackets(
+		newTestQueryEvent("test", "BEGIN"), newTestQueryEvent("test", "insert into t0 values(1)"), newTestXidEvent(),
+		newTestQueryEvent("test", "BEGIN"), newTestQueryEvent("test", "insert into t2 values(1)"), newTestQueryEvent("test", "COMMIT"),
+		newTestQueryEvent("test", "drop table t0"),
+		newTestQueryEvent("test", "BEGIN"), newTestQueryEvent("test", "insert into t1 values(1)"))
+	reader = NewNetBinlogReader("127.0.0.1", "reader", "123456", "", 3306, 5)
+	ends := make([]int64, 0, len(packets))
+	committed := make([]int64, 0, len(packets))
+	for _, packet := range packets {
+		if err := reader.handlePacket(packet); nil != err {
+			t.Fatal(err)
+		}
+		ends = append(ends, reader.lastPos)
+		committed = append(committed, reader.committedPos)
+	}
+	expect := []int64{0, 0, ends[2], ends[2], ends[2], ends[5], ends[6], ends[6], ends[6]}
+	if fmt.Sprint(committed) != fmt.Sprint(expect) {
+		t.Fatalf("got committed pos %v, expect %v", committed, expect)
+	}
+}
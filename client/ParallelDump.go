@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/SDHM/sqlregret/config"
+	"github.com/cihub/seelog"
+)
+
+// 一个binlog文件的解析结果
+type parallelResult struct {
+	output  *bytes.Buffer // 事务输出
+	console *bytes.Buffer // 提示信息, 与事务输出到同一个地方时与output相同
+	end     bool          // 是否超出了结束时间或结束位置
+	err     error
+}
+
+// 并行解析多个binlog文件, 每个binlog文件以FORMAT_DESCRIPTION_EVENT开始, 可以独立解析
+// 每个文件使用独立的LogContext与事务, 输出先写入缓冲区, 再按文件顺序输出, 结果与顺序解析相同
+// 同时解析的文件数不超过parallel, 已经解析完但还不能输出的文件也计算在内
+func (this *FileBinlogReader) DumpParallel(position uint32, filename string, parallel int) error {
+	//单个事务解析找到事务后立即退出, mark模式需要按顺序保存时间点, 表结构历史需要按顺序应用DDL, 都只能顺序解析
+	if parallel <= 1 || config.G_filterConfig.Xid != 0 || config.G_filterConfig.Mode == "mark" ||
+		config.G_filterConfig.SchemaFile != "" {
+		return this.Dump(position, filename)
+	}
+
+	if err := this.loadFileArray(filename); nil != err {
+		seelog.Error("获取binlog文件列表失败:", err.Error())
+		return err
+	}
+
+	start, err := this.startIndex(filename)
+	if nil != err {
+		return err
+	}
+	files := this.fileArray[start:]
+
+	results := make([]chan *parallelResult, len(files))
+	for i := range results {
+		results[i] = make(chan *parallelResult, 1)
+	}
+
+	//最早超出结束范围的文件, 之后的文件不再需要解析
+	endIndex := int32(len(files))
+	tokens := make(chan struct{}, parallel)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for i, path := range files {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			pos := uint32(4)
+			if i == 0 {
+				pos = position
+			}
+
+			go func(i int, path string, pos uint32) {
+				stop := func() bool {
+					return atomic.LoadInt32(&endIndex) < int32(i)
+				}
+
+				result := this.parseFileParallel(path, pos, stop)
+				if result.end {
+					for {
+						if old := atomic.LoadInt32(&endIndex); old <= int32(i) ||
+							atomic.CompareAndSwapInt32(&endIndex, old, int32(i)) {
+							break
+						}
+					}
+				}
+				results[i] <- result
+			}(i, path, pos)
+		}
+	}()
+
+	for i := range files {
+		result := <-results[i]
+		G_transaction.WriteAll(result.output.String())
+		if result.console != result.output {
+			G_transaction.Printf("%s", result.console.String())
+		}
+		<-tokens
+
+		if nil != result.err {
+			return result.err
+		}
+
+		//与顺序解析一致, 超出结束范围时退出
+		if result.end {
+			fmt.Println("解析完毕")
+			os.Exit(1)
+		}
+	}
+
+	seelog.Debug("到达最后一个文件")
+	return nil
+}
+
+// 在独立的reader中解析一个文件
+func (this *FileBinlogReader) parseFileParallel(path string, position uint32, stop func() bool) *parallelResult {
+	result := new(parallelResult)
+	result.output = new(bytes.Buffer)
+	result.console = result.output
+	if !G_transaction.SharedConsole() {
+		result.console = new(bytes.Buffer)
+	}
+
+	worker := NewFileBinlogReader(this.dbName, this.indexFile, this.basePath)
+	worker.tableMetaCache = this.tableMetaCache
+	worker.transaction = NewBufferTransaction(result.output, result.console)
+	worker.stop = stop
+	defer worker.Close()
+
+	if result.err = worker.changeBinlogFile(position, path); nil != result.err {
+		seelog.Error("打开文件失败:", result.err.Error())
+		return result
+	}
+
+	result.end, result.err = worker.parseFile()
+	return result
+}
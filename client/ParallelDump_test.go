@@ -0,0 +1,54 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/SDHM/sqlregret/binlogevent"
+	"github.com/SDHM/sqlregret/config"
+)
+
+// DDL语句的QUERY_EVENT
+func newTestQueryEvent(dbName string, query string) []byte {
+	event := []byte{binlogevent.QUERY_EVENT}
+	event = append(event, make([]byte, 8)...)
+	event = append(event, byte(len(dbName)), 0, 0, 0, 0)
+	event = append(event, dbName...)
+	event = append(event, 0)
+	return append(event, query...)
+}
+
+func TestDumpParallel(t *testing.T) {
+	dir := t.TempDir()
+	for i := 1; i <= 5; i++ {
+		events := make([][]byte, 0)
+		for j := 1; j <= 3; j++ {
+			events = append(events, newTestQueryEvent("test", fmt.Sprintf("create table t%d_%d (id int)", i, j)))
+		}
+		newTestBinlogFile(t, filepath.Join(dir, fmt.Sprintf("mysql-bin.%06d", i)), events...)
+	}
+
+	withDDL := config.G_filterConfig.WithDDL
+	config.G_filterConfig.WithDDL = true
+	defer func() {
+		config.G_filterConfig.WithDDL = withDDL
+	}()
+
+	var sequential bytes.Buffer
+	G_transaction = NewBufferTransaction(&sequential, &sequential)
+	if err := NewFileBinlogReader("", "", dir).Dump(4, "mysql-bin.000002"); nil != err {
+		t.Fatal(err)
+	}
+
+	var parallel bytes.Buffer
+	G_transaction = NewBufferTransaction(&parallel, &parallel)
+	if err := NewFileBinlogReader("", "", dir).DumpParallel(4, "mysql-bin.000002", 3); nil != err {
+		t.Fatal(err)
+	}
+
+	if sequential.Len() == 0 || sequential.String() != parallel.String() {
+		t.Fatalf("sequential:\n%s\nparallel:\n%s", sequential.String(), parallel.String())
+	}
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SDHM/sqlregret/config"
+	"github.com/SDHM/sqlregret/mysql"
+	"github.com/SDHM/sqlregret/protocol"
+	"github.com/cihub/seelog"
+)
+
+// PARTIAL_UPDATE_ROWS_EVENT修改后的值的选项, 有该标记时JSON列可以只记录修改的部分
+const PARTIAL_JSON_UPDATES = 1
+
+// 一行中部分修改的JSON列
+type partialJsonColumn struct {
+	diffs []*mysql.JsonDiff // binlog中记录的修改
+	undos []*mysql.JsonDiff // 撤销修改的操作, 按执行顺序排列; 没有修改前的值时为空
+}
+
+// 读取PARTIAL_UPDATE_ROWS_EVENT中的行
+// 修改前的值与UPDATE_ROWS_EVENT相同; 修改后的值前面有value_options, 以及表中每个JSON列一位的部分修改标记,
+// 标记的JSON列的值为修改列表, 在修改前的值上执行得到修改后的值
+func (this *LogParser) ReadPartialRows(
+	logHeader *LogHeader,
+	tableMapEvent *TableMapLogEvent,
+	columns []*Column,
+	beforePresent []byte,
+	afterPresent []byte,
+	logbuf *mysql.LogBuffer) []*protocol.RowData {
+	tableMeta := this.getTableMapMeta(tableMapEvent)
+
+	jsonCount := 0
+	for _, c := range columns {
+		if c.ColumnType == mysql.MYSQL_TYPE_JSON {
+			jsonCount++
+		}
+	}
+
+	rows := make([]*protocol.RowData, 0)
+	for logbuf.GetRestLength() > 0 {
+		row := new(protocol.RowData)
+
+		beforeNodes := make(map[int]*mysql.JsonNode)
+		nullBitmap := logbuf.GetVarLenBytes((countBits(beforePresent, len(columns)) + 7) / 8)
+		nullIndex := 0
+		for i, c := range columns {
+			if !IsNull(beforePresent, i) {
+				continue
+			}
+			column, value := this.readColumn(tableMapEvent, tableMeta, i, c, IsNull(nullBitmap, nullIndex), false, row, logbuf)
+			nullIndex++
+			if node, ok := value.(*mysql.JsonNode); ok {
+				beforeNodes[i] = node
+			}
+			row.BeforeColumns = append(row.BeforeColumns, column)
+		}
+
+		valueOptions, _ := logbuf.GetVarLen()
+		var partialBits []byte
+		if valueOptions&PARTIAL_JSON_UPDATES != 0 {
+			partialBits = logbuf.GetVarLenBytes((jsonCount + 7) / 8)
+		}
+
+		partials := make(map[int]*partialJsonColumn)
+		nullBitmap = logbuf.GetVarLenBytes((countBits(afterPresent, len(columns)) + 7) / 8)
+		nullIndex, jsonIndex := 0, 0
+		for i, c := range columns {
+			//每个JSON列都有一位标记, 不论是否在修改后的值中
+			isPartial := false
+			if c.ColumnType == mysql.MYSQL_TYPE_JSON {
+				isPartial = nil != partialBits && IsNull(partialBits, jsonIndex)
+				jsonIndex++
+			}
+			if !IsNull(afterPresent, i) {
+				continue
+			}
+
+			isNull := IsNull(nullBitmap, nullIndex)
+			nullIndex++
+			if isPartial && !isNull {
+				column, partial := this.readPartialJson(tableMapEvent, tableMeta, i, c, beforeNodes[i], row, logbuf)
+				partials[i] = partial
+				row.AfterColumns = append(row.AfterColumns, column)
+				continue
+			}
+
+			column, _ := this.readColumn(tableMapEvent, tableMeta, i, c, isNull, true, row, logbuf)
+			before := findColumn(row.BeforeColumns, i)
+			column.SetUpdated(nil == before || before.GetIsNull() != column.GetIsNull() || before.GetValue() != column.GetValue())
+			row.AfterColumns = append(row.AfterColumns, column)
+		}
+
+		this.transformToSqlPartialUpdate(logHeader, tableMapEvent, row.BeforeColumns, row.AfterColumns, partials)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// 读取JSON列的修改列表, 有修改前的值时还原出修改后的值
+func (this *LogParser) readPartialJson(
+	tableMapEvent *TableMapLogEvent,
+	tableMeta *TableMeta,
+	i int,
+	c *Column,
+	before *mysql.JsonNode,
+	row *protocol.RowData,
+	logbuf *mysql.LogBuffer) (*protocol.Column, *partialJsonColumn) {
+	//按空值读取只填充列名等信息, 不读取数据
+	column, _ := this.readColumn(tableMapEvent, tableMeta, i, c, true, true, row, logbuf)
+	column.SetIsNull(false)
+	column.SetValue("")
+	column.SetUpdated(true)
+
+	length := readJsonLength(logbuf, c.ColumnMeta)
+	column.SetLength(int32(length + c.ColumnMeta))
+
+	partial := new(partialJsonColumn)
+	diffs, err := mysql.ParseJsonDiffs(logbuf.GetVarLenBytes(length))
+	if nil != err {
+		seelog.Errorf("解析JSON列%s的部分修改失败:%s", column.GetName(), err.Error())
+		return column, partial
+	}
+	partial.diffs = diffs
+
+	if nil == before {
+		seelog.Warnf("JSON列%s没有修改前的值, 不能还原修改后的值", column.GetName())
+		return column, partial
+	}
+
+	after := before.Clone()
+	undos := make([]*mysql.JsonDiff, 0, len(diffs))
+	for _, diff := range diffs {
+		undo, err := after.Apply(diff)
+		if nil != err {
+			seelog.Errorf("JSON列%s执行部分修改失败:%s", column.GetName(), err.Error())
+			return column, partial
+		}
+		undos = append(undos, undo)
+	}
+	partial.undos = undos
+	column.SetValue(mysql.Escape(after.String()))
+	return column, partial
+}
+
+func (this *LogParser) transformToSqlPartialUpdate(
+	logHeader *LogHeader,
+	tableMapEvent *TableMapLogEvent,
+	before []*protocol.Column,
+	after []*protocol.Column,
+	partials map[int]*partialJsonColumn) {
+	sets := make([]string, 0, len(after))
+	regrets := make([]string, 0, len(after))
+	canRegret := true
+	for _, column := range after {
+		if !column.GetUpdated() {
+			continue
+		}
+
+		if partial, ok := partials[int(column.GetIndex())]; ok {
+			sets = append(sets, column.GetName()+"="+jsonDiffSql(column.GetName(), partial.diffs, false))
+			if len(partial.undos) != len(partial.diffs) || len(partial.diffs) == 0 {
+				canRegret = false
+			} else {
+				regrets = append(regrets, column.GetName()+"="+jsonDiffSql(column.GetName(), partial.undos, true))
+			}
+			continue
+		}
+
+		sets = append(sets, column.GetName()+"="+this.sqlValue(column))
+		if beforeColumn := findColumn(before, int(column.GetIndex())); nil != beforeColumn {
+			regrets = append(regrets, column.GetName()+"="+this.sqlValue(beforeColumn))
+		} else {
+			canRegret = false
+		}
+	}
+
+	if len(sets) == 0 {
+		return
+	}
+
+	keyColumn := findKeyColumn(before)
+	if nil == keyColumn {
+		keyColumn = findKeyColumn(after)
+	}
+	where := ""
+	if nil != keyColumn {
+		where = fmt.Sprintf(" where %s=%s", keyColumn.GetName(), this.sqlValue(keyColumn))
+	}
+
+	sql := fmt.Sprintf("update %s.%s set %s%s", tableMapEvent.DbName, tableMapEvent.TblName, strings.Join(sets, ", "), where)
+
+	timeSnap := time.Unix(logHeader.timeSnamp, 0)
+	rstSql := fmt.Sprintf("时间戳:%s\tpos:%d\tupdate语句:", timeSnap.Format("2006-01-02 15:04:05"), logHeader.GetLogPos())
+
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, sql+";", !config.G_filterConfig.Dump))
+
+	if !config.G_filterConfig.NeedReverse {
+		this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, "\n", true))
+		return
+	}
+
+	if !canRegret {
+		this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, "\t\t缺少修改前的值, 不能生成反向update语句\n", true))
+		return
+	}
+
+	sqlregret := fmt.Sprintf("update %s.%s set %s%s", tableMapEvent.DbName, tableMapEvent.TblName, strings.Join(regrets, ", "), where)
+	rstSql = fmt.Sprintf("\t\t对应的反向update语句:")
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(true, rstSql, !config.G_filterConfig.Dump))
+	this.GetTransaction().AppendSQL(&timeSnap, NewShowSql(false, sqlregret+";\n", true))
+}
+
+// 把JSON修改列表转换为嵌套的JSON_SET/JSON_ARRAY_INSERT/JSON_REMOVE, reverse为true时按相反顺序执行(撤销)
+func jsonDiffSql(name string, diffs []*mysql.JsonDiff, reverse bool) string {
+	expr := name
+	for i := range diffs {
+		diff := diffs[i]
+		if reverse {
+			diff = diffs[len(diffs)-1-i]
+		}
+
+		path := "'" + mysql.Escape(diff.Path) + "'"
+		switch {
+		case diff.Operation == mysql.JSON_DIFF_REMOVE:
+			expr = fmt.Sprintf("JSON_REMOVE(%s, %s)", expr, path)
+		case diff.Operation == mysql.JSON_DIFF_INSERT && diff.InArray():
+			expr = fmt.Sprintf("JSON_ARRAY_INSERT(%s, %s, CAST('%s' AS JSON))", expr, path, mysql.Escape(diff.Value.String()))
+		default:
+			expr = fmt.Sprintf("JSON_SET(%s, %s, CAST('%s' AS JSON))", expr, path, mysql.Escape(diff.Value.String()))
+		}
+	}
+	return expr
+}
+
+// 生成语句时列的值, 字符串类型加引号
+func (this *LogParser) sqlValue(column *protocol.Column) string {
+	if column.GetIsNull() {
+		return "NULL"
+	}
+	if this.isSqlTypeString(JavaType(column.GetSqlType())) {
+		return "'" + column.GetValue() + "'"
+	}
+	return column.GetValue()
+}
+
+func findColumn(columns []*protocol.Column, index int) *protocol.Column {
+	for _, column := range columns {
+		if int(column.GetIndex()) == index {
+			return column
+		}
+	}
+	return nil
+}
+
+func findKeyColumn(columns []*protocol.Column) *protocol.Column {
+	for _, column := range columns {
+		if column.GetIsKey() {
+			return column
+		}
+	}
+	return nil
+}
+
+// 位图中前count位有多少位为1
+func countBits(bitmap []byte, count int) int {
+	n := 0
+	for i := 0; i < count; i++ {
+		if IsNull(bitmap, i) {
+			n++
+		}
+	}
+	return n
+}
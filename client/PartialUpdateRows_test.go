@@ -0,0 +1,55 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/SDHM/sqlregret/config"
+	"github.com/SDHM/sqlregret/mysql"
+)
+
+func TestReadPartialRows(t *testing.T) {
+	needReverse := config.G_filterConfig.NeedReverse
+	config.G_filterConfig.NeedReverse = true
+	defer func() {
+		config.G_filterConfig.NeedReverse = needReverse
+	}()
+
+	var output bytes.Buffer
+	parser := &LogParser{context: NewLogContext(), transaction: NewBufferTransaction(&output, &output)}
+	parser.GetTransaction().Begin("", "mysql-bin.000001", 4)
+
+	tableMapEvent := &TableMapLogEvent{DbName: "test", TblName: "t1", ColumnCnt: 2}
+	tableMapEvent.ColumnInfo = []*Column{{ColumnType: mysql.MYSQL_TYPE_LONG}, {ColumnType: mysql.MYSQL_TYPE_JSON, ColumnMeta: 4}}
+	tableMapEvent.TableMeta = NewTableMeta("test.t1", []*FieldMeta{
+		{ColumnName: "id", ColumnType: "int", IsKey: "PRI"},
+		{ColumnName: "doc", ColumnType: "json"},
+	})
+
+	//修改前: 1, {"b": "x"}
+	row := []byte{0, 1, 0, 0, 0, 15, 0, 0, 0}
+	row = append(row, mysql.JSONB_TYPE_SMALL_OBJECT, 1, 0, 14, 0, 11, 0, 1, 0, mysql.JSONB_TYPE_STRING, 12, 0, 'b', 1, 'x')
+	//修改后: value_options, 部分修改标记, NULL标记, 1, JSON_SET(doc, '$.b', 'y')
+	row = append(row, PARTIAL_JSON_UPDATES, 1, 0, 1, 0, 0, 0, 9, 0, 0, 0)
+	row = append(row, mysql.JSON_DIFF_REPLACE, 3, '$', '.', 'b', 3, mysql.JSONB_TYPE_STRING, 1, 'y')
+
+	rows := parser.ReadPartialRows(&LogHeader{}, tableMapEvent, tableMapEvent.ColumnInfo, []byte{3}, []byte{3}, mysql.NewLogBuffer(row))
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	if got := rows[0].AfterColumns[1].GetValue(); got != `{\"b\": \"y\"}` {
+		t.Fatalf("got after value %s", got)
+	}
+
+	sqls := ""
+	for _, sql := range parser.GetTransaction().sqlArray {
+		if !sql.BePrompt() {
+			sqls += sql.GetSql()
+		}
+	}
+	expect := `update test.t1 set doc=JSON_SET(doc, '$.b', CAST('\"y\"' AS JSON)) where id=1;` +
+		`update test.t1 set doc=JSON_SET(doc, '$.b', CAST('\"x\"' AS JSON)) where id=1;` + "\n"
+	if sqls != expect {
+		t.Fatalf("got %q", sqls)
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"strings"
+	"sync"
+)
+
+// 表结构的一个版本, 从(fileIndex, pos)开始生效, meta为空表示表已删除
+type schemaVersion struct {
+	fileIndex int
+	pos       int64
+	meta      *TableMeta
+}
+
+func (this *schemaVersion) after(fileIndex int, pos int64) bool {
+	return this.fileIndex > fileIndex || (this.fileIndex == fileIndex && this.pos > pos)
+}
+
+// 表结构历史, 以快照为初始版本, 把binlog中的DDL应用到本地的表结构上
+// 行事件使用其位置上生效的表结构解析, 不受之后的DDL影响
+type SchemaHistory struct {
+	lock   sync.Mutex
+	tables map[string][]*schemaVersion // 库名.表名 -> 按位置排列的版本
+}
+
+func NewSchemaHistory() *SchemaHistory {
+	this := new(SchemaHistory)
+	this.tables = make(map[string][]*schemaVersion, 10)
+	return this
+}
+
+// 初始版本, 在所有DDL之前生效
+func (this *SchemaHistory) Seed(tableMeta *TableMeta) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.tables[tableMeta.FullName] = []*schemaVersion{{meta: tableMeta}}
+}
+
+// 位置(fileIndex, pos)上生效的表结构
+func (this *SchemaHistory) Lookup(fullName string, fileIndex int, pos int64) *TableMeta {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	versions := this.tables[fullName]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].after(fileIndex, pos) {
+			return versions[i].meta
+		}
+	}
+	return nil
+}
+
+// 最新的表结构
+func (this *SchemaHistory) Latest(fullName string) *TableMeta {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.latest(fullName)
+}
+
+func (this *SchemaHistory) latest(fullName string) *TableMeta {
+	if versions := this.tables[fullName]; len(versions) > 0 {
+		return versions[len(versions)-1].meta
+	}
+	return nil
+}
+
+func (this *SchemaHistory) put(fullName string, fileIndex int, pos int64, tableMeta *TableMeta) {
+	version := &schemaVersion{fileIndex: fileIndex, pos: pos, meta: tableMeta}
+	versions := this.tables[fullName]
+
+	//重复解析同一段binlog时丢弃之后的版本, 同一个语句多次修改同一个表时只保留最后的结果
+	for len(versions) > 0 {
+		last := versions[len(versions)-1]
+		if !last.after(fileIndex, pos) && (last.fileIndex != fileIndex || last.pos != pos) {
+			break
+		}
+		versions = versions[:len(versions)-1]
+	}
+	this.tables[fullName] = append(versions, version)
+}
+
+// 应用QUERY_EVENT中的DDL, schema为语句执行时的默认库, 返回是否修改了表结构
+// 支持CREATE TABLE、ALTER TABLE、DROP TABLE、RENAME TABLE、DROP DATABASE, 其他语句忽略
+func (this *SchemaHistory) Apply(schema string, sql string, fileIndex int, pos int64) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	changed := false
+	parser := newDDLParser(sql, schema)
+	parser.get = this.latest
+	parser.set = func(fullName string, tableMeta *TableMeta) {
+		this.put(fullName, fileIndex, pos, tableMeta)
+		changed = true
+	}
+	parser.dropSchema = func(schema string) {
+		prefix := schema + "."
+		for fullName := range this.tables {
+			if strings.HasPrefix(fullName, prefix) && nil != this.latest(fullName) {
+				parser.set(fullName, nil)
+			}
+		}
+	}
+	parser.parse()
+	return changed
+}
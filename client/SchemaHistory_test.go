@@ -0,0 +1,93 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func columnsOf(tableMeta *TableMeta) string {
+	if nil == tableMeta {
+		return "<nil>"
+	}
+	columns := make([]string, 0, len(tableMeta.Fileds))
+	for _, field := range tableMeta.Fileds {
+		columns = append(columns, field.ColumnName+" "+field.ColumnType+" "+field.IsNullable+" "+field.IsKey)
+	}
+	return strings.Join(columns, ", ")
+}
+
+func TestSchemaHistory(t *testing.T) {
+	history := NewSchemaHistory()
+	history.Seed(NewTableMeta("test.t0", []*FieldMeta{{ColumnName: "id", ColumnType: "int(11)", IsNullable: "NO", IsKey: "PRI"}}))
+
+	ddls := []struct {
+		schema string
+		sql    string
+		pos    int64
+	}{
+		{"test", "CREATE TABLE `t1` (\n  `id` int(11) unsigned NOT NULL AUTO_INCREMENT COMMENT 'a,b',\n  `name` varchar(20) DEFAULT 'x',\n" +
+			"  state enum('a','b') NOT NULL,\n  PRIMARY KEY (`id`),\n  KEY `idx_name` (`name`(10))\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", 100},
+		{"other", "alter table test.t1 add column age tinyint after id, drop name, modify `state` enum('a','b','c') first", 200},
+		{"test", "ALTER TABLE t1 CHANGE age years smallint NOT NULL, ADD (c1 date, c2 blob), ALGORITHM=INPLACE", 300},
+		{"test", "RENAME TABLE t1 TO t2, t0 TO t1", 400},
+		{"test", "DROP TABLE IF EXISTS `t1` /* generated by server */", 500},
+		{"test", "insert into t2 values (1)", 600},
+		{"test", "create table t3 (id bigint key, code varchar(50) UNIQUE KEY, flag int unique)", 700},
+		{"test", "CREATE TEMPORARY TABLE t3 (a int, b int)", 800},
+		{"test", "DROP TEMPORARY TABLE t3", 900},
+		{"test", "DROP /*!40005 TEMPORARY */ TABLE IF EXISTS `t3`", 1000},
+	}
+	for _, ddl := range ddls {
+		history.Apply(ddl.schema, ddl.sql, 1, ddl.pos)
+	}
+
+	cases := []struct {
+		fullName string
+		pos      int64
+		expect   string
+	}{
+		{"test.t1", 50, "<nil>"},
+		{"test.t1", 150, "id int(11) unsigned NO PRI, name varchar(20) YES , state enum('a','b') NO "},
+		{"test.t1", 250, "state enum('a','b','c') YES , id int(11) unsigned NO PRI, age tinyint YES "},
+		{"test.t1", 350, "state enum('a','b','c') YES , id int(11) unsigned NO PRI, years smallint NO , c1 date YES , c2 blob YES "},
+		{"test.t2", 450, "state enum('a','b','c') YES , id int(11) unsigned NO PRI, years smallint NO , c1 date YES , c2 blob YES "},
+		{"test.t1", 450, "id int(11) NO PRI"},
+		{"test.t1", 550, "<nil>"},
+		{"test.t0", 350, "id int(11) NO PRI"},
+		{"test.t0", 450, "<nil>"},
+		{"test.t3", 750, "id bigint NO PRI, code varchar(50) YES UNI, flag int YES UNI"},
+		{"test.t3", 1050, "id bigint NO PRI, code varchar(50) YES UNI, flag int YES UNI"},
+	}
+	for _, c := range cases {
+		if got := columnsOf(history.Lookup(c.fullName, 1, c.pos)); got != c.expect {
+			t.Errorf("%s at %d: got %q, expect %q", c.fullName, c.pos, got, c.expect)
+		}
+	}
+
+	//之前的文件使用初始版本
+	if got := columnsOf(history.Lookup("test.t0", 0, 1000)); got != "id int(11) NO PRI" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDDLCollation(t *testing.T) {
+	history := NewSchemaHistory()
+	history.Apply("test", "create table t1 (id int, name varchar(10), memo text character set latin1, tag varchar(5) collate utf8mb4_bin)"+
+		" engine=InnoDB default charset=gbk", 1, 100)
+	history.Apply("test", "alter table t1 convert to character set utf8mb4", 1, 200)
+
+	collations := func(pos int64) string {
+		tableMeta := history.Lookup("test.t1", 1, pos)
+		names := make([]string, 0, len(tableMeta.Fileds))
+		for _, field := range tableMeta.Fileds {
+			names = append(names, field.Collation)
+		}
+		return strings.Join(names, ",")
+	}
+	if got := collations(150); got != ",gbk_chinese_ci,latin1_swedish_ci,utf8mb4_bin" {
+		t.Fatalf("got %s", got)
+	}
+	if got := collations(250); got != ",utf8mb4_general_ci,utf8mb4_general_ci,utf8mb4_general_ci" {
+		t.Fatalf("got %s", got)
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/SDHM/sqlregret/mysql"
+	"github.com/cihub/seelog"
+)
+
+// 表结构快照, 用于没有数据库连接时解析binlog
+type SchemaSnapshot struct {
+	Time   string                  `json:"time"`   // 导出时间
+	Tables map[string][]*FieldMeta `json:"tables"` // 库名.表名 -> desc结果
+}
+
+// 没有数据库连接, 表结构来自快照, 之后按binlog中的DDL修改
+func NewSnapshotTableMetaCache(path string) (*TableMetaCache, error) {
+	this := NewTableMetaCache(nil)
+	if err := this.LoadSnapshot(path); nil != err {
+		return nil, err
+	}
+
+	this.history = NewSchemaHistory()
+	for _, tableMeta := range this.tableMetaCacheMap {
+		this.history.Seed(tableMeta)
+	}
+	return this, nil
+}
+
+// 导出数据库的表结构, dbName、tableName为空时导出所有非系统库的表
+func (this *TableMetaCache) ExportSnapshot(dbName string, tableName string) error {
+	if nil == this.reader {
+		return errors.New("没有数据库连接, 不能导出表结构")
+	}
+
+	sql := "select table_schema, table_name from information_schema.tables where table_type = 'BASE TABLE'" +
+		" and table_schema not in ('mysql', 'information_schema', 'performance_schema', 'sys')"
+	if dbName != "" {
+		sql += fmt.Sprintf(" and table_schema = '%s'", mysql.Escape(dbName))
+	}
+	if tableName != "" {
+		sql += fmt.Sprintf(" and table_name = '%s'", mysql.Escape(tableName))
+	}
+
+	rst, err := this.reader.Query(sql)
+	if nil != err {
+		return err
+	}
+
+	for i := 0; i < rst.RowNumber(); i++ {
+		schema, _ := rst.GetString(i, 0)
+		table, _ := rst.GetString(i, 1)
+		if nil == this.getTableMeta(schema+"."+table, true) {
+			return fmt.Errorf("获取表结构失败:%s.%s", schema, table)
+		}
+	}
+	return nil
+}
+
+// 把缓存的表结构保存到快照文件
+func (this *TableMetaCache) SaveSnapshot(path string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	snapshot := new(SchemaSnapshot)
+	snapshot.Time = time.Now().Format("2006-01-02 15:04:05")
+	snapshot.Tables = make(map[string][]*FieldMeta, len(this.tableMetaCacheMap))
+	for fullName, tableMeta := range this.tableMetaCacheMap {
+		snapshot.Tables[fullName] = tableMeta.Fileds
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if nil != err {
+		return err
+	}
+
+	//先写临时文件再改名, 导出失败时不破坏原有的快照
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); nil != err {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// 从快照文件读取表结构
+func (this *TableMetaCache) LoadSnapshot(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return err
+	}
+
+	snapshot := new(SchemaSnapshot)
+	if err := json.Unmarshal(data, snapshot); nil != err {
+		return fmt.Errorf("表结构快照%s格式错误:%s", path, err.Error())
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for fullName, fields := range snapshot.Tables {
+		this.tableMetaCacheMap[fullName] = NewTableMeta(fullName, fields)
+	}
+	seelog.Infof("读取表结构快照 文件:%s\t导出时间:%s\t表数量:%d", path, snapshot.Time, len(snapshot.Tables))
+	return nil
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+
+	tableMetaCache := NewTableMetaCache(nil)
+	tableMetaCache.tableMetaCacheMap["test.t1"] = NewTableMeta("test.t1", []*FieldMeta{
+		{ColumnName: "id", ColumnType: "int(11)", IsNullable: "NO", IsKey: "PRI"},
+		{ColumnName: "name", ColumnType: "varchar(20)", IsNullable: "YES", DefaultValue: "a"},
+	})
+	if err := tableMetaCache.SaveSnapshot(path); nil != err {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewSnapshotTableMetaCache(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	tableMeta := loaded.getTableMeta("test.t1", false)
+	if nil == tableMeta || len(tableMeta.Fileds) != 2 {
+		t.Fatalf("got %+v", tableMeta)
+	}
+	if *tableMeta.Fileds[1] != *tableMetaCache.tableMetaCacheMap["test.t1"].Fileds[1] || !tableMeta.Fileds[0].IsThisKey() {
+		t.Fatalf("got %+v", tableMeta.Fileds)
+	}
+
+	//快照中没有的表, 以及DDL后刷新都不会查询数据库
+	if nil != loaded.getTableMeta("test.t2", false) || nil == loaded.getTableMeta("test.t1", true) {
+		t.Fatal("snapshot cache should not query db")
+	}
+}
@@ -11,11 +11,12 @@ import (
 )
 
 // 返回为false 表示不过滤 返回为true 表示过滤
-func FilterSkipSQL(eventType int) bool {
+func FilterSkipSQL(eventType int, transaction *Transaction) bool {
 
 	// 如果eventType不是这六个之间的一个, 则不过滤
 	if eventType != binlogevent.UPDATE_ROWS_EVENT_V1 &&
 		eventType != binlogevent.UPDATE_ROWS_EVENT &&
+		eventType != binlogevent.PARTIAL_UPDATE_ROWS_EVENT &&
 		eventType != binlogevent.DELETE_ROWS_EVENT_V1 &&
 		eventType != binlogevent.DELETE_ROWS_EVENT &&
 		eventType != binlogevent.WRITE_ROWS_EVENT_V1 &&
@@ -32,9 +33,10 @@ func FilterSkipSQL(eventType int) bool {
 		{
 			if eventType == binlogevent.UPDATE_ROWS_EVENT_V1 ||
 				eventType == binlogevent.UPDATE_ROWS_EVENT ||
+				eventType == binlogevent.PARTIAL_UPDATE_ROWS_EVENT ||
 				eventType == binlogevent.DELETE_ROWS_EVENT_V1 ||
 				eventType == binlogevent.DELETE_ROWS_EVENT {
-				G_transaction.SkipSomeThing()
+				transaction.SkipSomeThing()
 				return true
 			} else if eventType == binlogevent.WRITE_ROWS_EVENT_V1 ||
 				eventType == binlogevent.WRITE_ROWS_EVENT {
@@ -45,9 +47,10 @@ func FilterSkipSQL(eventType int) bool {
 		{
 			if eventType == binlogevent.UPDATE_ROWS_EVENT_V1 ||
 				eventType == binlogevent.UPDATE_ROWS_EVENT ||
+				eventType == binlogevent.PARTIAL_UPDATE_ROWS_EVENT ||
 				eventType == binlogevent.WRITE_ROWS_EVENT_V1 ||
 				eventType == binlogevent.WRITE_ROWS_EVENT {
-				G_transaction.SkipSomeThing()
+				transaction.SkipSomeThing()
 				return true
 			} else if eventType == binlogevent.DELETE_ROWS_EVENT_V1 ||
 				eventType == binlogevent.DELETE_ROWS_EVENT {
@@ -60,10 +63,11 @@ func FilterSkipSQL(eventType int) bool {
 				eventType == binlogevent.DELETE_ROWS_EVENT ||
 				eventType == binlogevent.WRITE_ROWS_EVENT_V1 ||
 				eventType == binlogevent.WRITE_ROWS_EVENT {
-				G_transaction.SkipSomeThing()
+				transaction.SkipSomeThing()
 				return true
 			} else if eventType == binlogevent.UPDATE_ROWS_EVENT_V1 ||
-				eventType == binlogevent.UPDATE_ROWS_EVENT {
+				eventType == binlogevent.UPDATE_ROWS_EVENT ||
+				eventType == binlogevent.PARTIAL_UPDATE_ROWS_EVENT {
 				return false
 			}
 		}
@@ -80,7 +84,8 @@ func FilterMode(eventType int) bool {
 	if config.G_filterConfig.Mode == "mark" {
 		if eventType == binlogevent.FORMAT_DESCRIPTION_EVENT ||
 			eventType == binlogevent.TABLE_MAP_EVENT ||
-			eventType == binlogevent.ROTATE_EVENT {
+			eventType == binlogevent.ROTATE_EVENT ||
+			eventType == binlogevent.GTID_LOG_EVENT {
 			return false
 		} else {
 			return true
@@ -92,9 +97,20 @@ func FilterMode(eventType int) bool {
 	}
 }
 
+// 是否超出了结束时间
+func ReachEndTime(timeSnap time.Time) bool {
+	return config.G_filterConfig.EndTimeEnable() && timeSnap.After(config.G_filterConfig.EndTime)
+}
+
+// 是否超出了结束位置, 文件索引超过了停止索引, 或者当前文件索引等于停止索引并且当前位置大于停止位置
+func ReachEndPos(fileIndex int, pos int64) bool {
+	return config.G_filterConfig.EndPosEnable() &&
+		(fileIndex > config.G_filterConfig.EndFileIndex || (fileIndex == config.G_filterConfig.EndFileIndex && int(pos) > config.G_filterConfig.EndPos))
+}
+
 func FilterTime(timeSnap time.Time, eventType int) bool {
 
-	if config.G_filterConfig.EndTimeEnable() && timeSnap.After(config.G_filterConfig.EndTime) {
+	if ReachEndTime(timeSnap) {
 		fmt.Println("解析完毕")
 		os.Exit(1)
 	}
@@ -107,6 +123,7 @@ func FilterTime(timeSnap time.Time, eventType int) bool {
 			//时间在两者之外，并且不是修改操作的直接跳过
 			if eventType == binlogevent.WRITE_ROWS_EVENT_V1 || eventType == binlogevent.WRITE_ROWS_EVENT ||
 				eventType == binlogevent.UPDATE_ROWS_EVENT_V1 || eventType == binlogevent.UPDATE_ROWS_EVENT ||
+				eventType == binlogevent.PARTIAL_UPDATE_ROWS_EVENT ||
 				eventType == binlogevent.DELETE_ROWS_EVENT_V1 || eventType == binlogevent.DELETE_ROWS_EVENT {
 				return true
 			} else {
@@ -126,12 +143,10 @@ func FilterTime(timeSnap time.Time, eventType int) bool {
 
 func FilterPos(eventType int, fileIndex int, pos int64) bool {
 
-	if config.G_filterConfig.EndPosEnable() {
-		//如果文件索引超过了停止索引, 或者当前文件索引等于停止索引并且当前位置大于停止位置，则停止解析
-		if fileIndex > config.G_filterConfig.EndFileIndex || (fileIndex == config.G_filterConfig.EndFileIndex && int(pos) > config.G_filterConfig.EndPos) {
-			fmt.Println("解析完毕")
-			os.Exit(1)
-		}
+	//超出了结束位置则停止解析
+	if ReachEndPos(fileIndex, pos) {
+		fmt.Println("解析完毕")
+		os.Exit(1)
 	}
 
 	if config.G_filterConfig.StartPosEnable() && config.G_filterConfig.EndPosEnable() {
@@ -143,6 +158,7 @@ func FilterPos(eventType int, fileIndex int, pos int64) bool {
 		} else {
 			if eventType == binlogevent.WRITE_ROWS_EVENT_V1 || eventType == binlogevent.WRITE_ROWS_EVENT ||
 				eventType == binlogevent.UPDATE_ROWS_EVENT_V1 || eventType == binlogevent.UPDATE_ROWS_EVENT ||
+				eventType == binlogevent.PARTIAL_UPDATE_ROWS_EVENT ||
 				eventType == binlogevent.DELETE_ROWS_EVENT_V1 || eventType == binlogevent.DELETE_ROWS_EVENT {
 				return true
 			} else {
@@ -156,6 +172,7 @@ func FilterPos(eventType int, fileIndex int, pos int64) bool {
 		} else {
 			if eventType == binlogevent.WRITE_ROWS_EVENT_V1 || eventType == binlogevent.WRITE_ROWS_EVENT ||
 				eventType == binlogevent.UPDATE_ROWS_EVENT_V1 || eventType == binlogevent.UPDATE_ROWS_EVENT ||
+				eventType == binlogevent.PARTIAL_UPDATE_ROWS_EVENT ||
 				eventType == binlogevent.DELETE_ROWS_EVENT_V1 || eventType == binlogevent.DELETE_ROWS_EVENT {
 				return true
 			} else {
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	. "github.com/SDHM/sqlregret/mysql"
+	"github.com/cihub/seelog"
+)
+
+// 从标准输入或任意io.Reader读取一个binlog文件的数据流, 如 mysqlbinlog --raw 的输出
+// 数据流可以是gzip或zstd压缩的, 按数据头识别
+type StreamBinlogReader struct {
+	FileBinlogReader
+	source io.Reader
+}
+
+func NewStreamBinlogReader(dbName string, source io.Reader) *StreamBinlogReader {
+	this := new(StreamBinlogReader)
+	this.dbName = dbName
+	this.source = source
+	this.context = NewLogContext()
+	return this
+}
+
+//Dump日志, filename为数据流对应的binlog文件名, 用于输出以及按位置过滤, 可以为空
+func (this *StreamBinlogReader) Dump(position uint32, filename string) error {
+	if filename == "" {
+		filename = "stdin"
+	}
+	this.binlogFileName = TrimCompressSuffix(filename)
+	if fileIndex, err := BinlogFileIndex(filename); nil == err {
+		this.fileIndex = fileIndex
+	}
+
+	reader, closeFunc, err := decompressBinlog(this.source, "")
+	if nil != err {
+		seelog.Error("读取binlog数据流失败:", err.Error())
+		return err
+	}
+	if nil != closeFunc {
+		defer closeFunc()
+	}
+
+	if err := this.startStream(reader, nil, position, this.binlogFileName); nil != err {
+		seelog.Error("读取binlog数据流失败:", err.Error())
+		return err
+	}
+
+	_, err = this.parseFile()
+	return err
+}
+
+//数据流只有一个binlog文件
+func (this *StreamBinlogReader) ListBinlogFiles(startFile string) ([]string, error) {
+	return nil, errors.New("数据流模式不支持列出binlog文件")
+}
+
+func (this *StreamBinlogReader) GetFirstEventTime(fileName string) (time.Time, error) {
+	return time.Time{}, errors.New("数据流模式不支持读取binlog文件的时间")
+}
+
+func (this *StreamBinlogReader) DumpGtid(gtidSet *GtidSet) error {
+	return errors.New("数据流模式不支持按GTID集合dump")
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SDHM/sqlregret/config"
+)
+
+func TestStreamBinlogReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mysql-bin.000042")
+	newTestBinlogFile(t, path, newTestQueryEvent("test", "create table t1 (id int)"), newTestQueryEvent("test", "drop table t0"))
+	data, _ := os.ReadFile(path)
+
+	withDDL := config.G_filterConfig.WithDDL
+	config.G_filterConfig.WithDDL = true
+	defer func() {
+		config.G_filterConfig.WithDDL = withDDL
+	}()
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(data)
+	gw.Close()
+
+	executeTime := time.Unix(0, 0).Format("2006-01-02 15:04:05")
+	expect := "DDL语句:create table t1 (id int)\n时间:" + executeTime + "\t线程:0\t类型:CREATE\t表:test.t1\n" +
+		"DDL语句:drop table t0\n时间:" + executeTime + "\t线程:0\t类型:ERASE\t表:test.t0\n"
+	for _, source := range [][]byte{data, gz.Bytes()} {
+		var output bytes.Buffer
+		G_transaction = NewBufferTransaction(&output, &output)
+		if err := NewStreamBinlogReader("", bytes.NewReader(source)).Dump(4, ""); nil != err {
+			t.Fatal(err)
+		}
+		if output.String() != expect {
+			t.Fatalf("got %q", output.String())
+		}
+	}
+
+	if err := NewStreamBinlogReader("", bytes.NewReader(data[4:])).Dump(4, ""); nil == err {
+		t.Fatal("stream without binlog magic should fail")
+	}
+}
@@ -20,6 +20,8 @@ type TableMapLogEvent struct {
 	ColumnInfo []*Column
 	TableID    int64
 	NullBitset []byte
+	Metadata   *TableMapMetadata // 可选元数据, MySQL 8.0 binlog_row_metadata
+	TableMeta  *TableMeta        // 元数据中有列名时生成的表结构
 }
 
 func ParseTableMapLogEvent(logbuf *LogBuffer,
@@ -66,6 +68,10 @@ func ParseTableMapLogEvent(logbuf *LogBuffer,
 		this.NullBitset = logbuf.GetVarLenBytes(int((this.ColumnCnt + 7) / 8))
 	}
 
+	if logbuf.HasMore() {
+		this.decodeOptionalMetadata(logbuf)
+	}
+
 	return this
 }
 
@@ -76,7 +82,7 @@ func (this *TableMapLogEvent) decodeFields(logbuf *LogBuffer, fieldSize uint64)
 		switch info.ColumnType {
 		case MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_BLOB,
 			MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB,
-			MYSQL_TYPE_DOUBLE, MYSQL_TYPE_FLOAT, MYSQL_TYPE_GEOMETRY:
+			MYSQL_TYPE_DOUBLE, MYSQL_TYPE_FLOAT, MYSQL_TYPE_GEOMETRY, MYSQL_TYPE_JSON:
 			{
 				info.ColumnMeta = logbuf.GetUInt8()
 			}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/SDHM/sqlregret/mysql"
+)
+
+// binlog_row_metadata=FULL时的TABLE_MAP_EVENT:
+// create table test.t1 (id int unsigned primary key, name varchar(20) not null, state enum('a','b'), data blob)
+func newTestTableMapEvent() []byte {
+	event := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	event = append(event, 4, 't', 'e', 's', 't', 0, 2, 't', '1', 0)
+	event = append(event, 4, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_BLOB)
+	event = append(event, 5, 80, 0, mysql.MYSQL_TYPE_ENUM, 1, 2)
+	event = append(event, 0x0c)
+
+	event = append(event, TABLE_MAP_SIGNEDNESS, 1, 0x80)
+	event = append(event, TABLE_MAP_DEFAULT_CHARSET, 3, 45, 1, BINARY_CHARSET_ID)
+	event = append(event, TABLE_MAP_COLUMN_NAME, 19, 2, 'i', 'd', 4, 'n', 'a', 'm', 'e', 5, 's', 't', 'a', 't', 'e', 4, 'd', 'a', 't', 'a')
+	event = append(event, TABLE_MAP_ENUM_STR_VALUE, 5, 2, 1, 'a', 1, 'b')
+	event = append(event, TABLE_MAP_SIMPLE_PRIMARY_KEY, 1, 0)
+	return event
+}
+
+func TestTableMapMetadata(t *testing.T) {
+	tableMapEvent := ParseTableMapLogEvent(mysql.NewLogBuffer(newTestTableMapEvent()), NewFormatDesctiptionLogEvent(4))
+	if nil == tableMapEvent.TableMeta {
+		t.Fatal("table meta not built from optional metadata")
+	}
+
+	expect := []FieldMeta{
+		{ColumnName: "id", ColumnType: "int unsigned", IsNullable: "NO", IsKey: "PRI"},
+		{ColumnName: "name", ColumnType: "varchar", IsNullable: "NO"},
+		{ColumnName: "state", ColumnType: "enum('a','b')", IsNullable: "YES"},
+		{ColumnName: "data", ColumnType: "blob", IsNullable: "YES"},
+	}
+	for i, field := range tableMapEvent.TableMeta.Fileds {
+		if *field != expect[i] {
+			t.Fatalf("column %d: got %+v, expect %+v", i, *field, expect[i])
+		}
+	}
+
+	if !tableMapEvent.TableMeta.Fileds[0].IsThisKey() {
+		t.Fatal("id should be primary key")
+	}
+}
+
+func TestReadRowCharset(t *testing.T) {
+	parser := &LogParser{context: NewLogContext()}
+	tableMapEvent := &TableMapLogEvent{DbName: "test", TblName: "t1", ColumnCnt: 2}
+	tableMapEvent.ColumnInfo = []*Column{{ColumnType: mysql.MYSQL_TYPE_VARCHAR, ColumnMeta: 20}, {ColumnType: mysql.MYSQL_TYPE_VARCHAR, ColumnMeta: 20}}
+	tableMapEvent.Metadata = &TableMapMetadata{Charsets: []int{28, 0}}
+	tableMapEvent.TableMeta = NewTableMeta("test.t1", []*FieldMeta{
+		{ColumnName: "name", ColumnType: "varchar(10)"},
+		{ColumnName: "memo", ColumnType: "varchar(10)", Collation: "gbk_chinese_ci"},
+	})
+
+	//name为gbk编码的"中文", memo不是合法的gbk编码
+	data := []byte{4, 0xd6, 0xd0, 0xce, 0xc4, 2, 0xff, 0x41}
+	columns := parser.ReadRow(tableMapEvent, false, nil, tableMapEvent.ColumnInfo, []byte{0}, mysql.NewLogBuffer(data))
+	if columns[0].GetValue() != "中文" {
+		t.Fatalf("got %q", columns[0].GetValue())
+	}
+	if columns[1].GetValue() != "_gbk X'FF41'" || parser.isSqlTypeString(JavaType(columns[1].GetSqlType())) {
+		t.Fatalf("got %q", columns[1].GetValue())
+	}
+}
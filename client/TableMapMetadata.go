@@ -0,0 +1,295 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/SDHM/sqlregret/mysql"
+)
+
+// TABLE_MAP_EVENT可选元数据的类型(MySQL 8.0 binlog_row_metadata)
+const (
+	TABLE_MAP_SIGNEDNESS                   = 1
+	TABLE_MAP_DEFAULT_CHARSET              = 2
+	TABLE_MAP_COLUMN_CHARSET               = 3
+	TABLE_MAP_COLUMN_NAME                  = 4
+	TABLE_MAP_SET_STR_VALUE                = 5
+	TABLE_MAP_ENUM_STR_VALUE               = 6
+	TABLE_MAP_GEOMETRY_TYPE                = 7
+	TABLE_MAP_SIMPLE_PRIMARY_KEY           = 8
+	TABLE_MAP_PRIMARY_KEY_WITH_PREFIX      = 9
+	TABLE_MAP_ENUM_AND_SET_DEFAULT_CHARSET = 10
+	TABLE_MAP_ENUM_AND_SET_COLUMN_CHARSET  = 11
+	TABLE_MAP_COLUMN_VISIBILITY            = 12
+)
+
+// binary字符集, 使用该字符集的字符列是二进制列
+const BINARY_CHARSET_ID = 63
+
+// TABLE_MAP_EVENT的可选元数据, 每个切片都按列排列
+type TableMapMetadata struct {
+	Unsigned    []bool     // 数字列是否为unsigned
+	Charsets    []int      // 字符列的字符集, 0表示未知
+	ColumnNames []string   // 列名
+	EnumValues  [][]string // ENUM列的取值
+	SetValues   [][]string // SET列的取值
+	PrimaryKeys []int      // 主键列的序号
+}
+
+// 列的实际类型, ENUM、SET在binlog中记录为MYSQL_TYPE_STRING, 实际类型在meta的高字节
+func (this *Column) RealType() byte {
+	if this.ColumnType == MYSQL_TYPE_STRING {
+		if realType := byte(this.ColumnMeta >> 8); realType == MYSQL_TYPE_ENUM || realType == MYSQL_TYPE_SET {
+			return realType
+		}
+	}
+	return this.ColumnType
+}
+
+func (this *Column) isNumeric() bool {
+	switch this.RealType() {
+	case MYSQL_TYPE_TINY, MYSQL_TYPE_SHORT, MYSQL_TYPE_INT24, MYSQL_TYPE_LONG, MYSQL_TYPE_LONGLONG,
+		MYSQL_TYPE_FLOAT, MYSQL_TYPE_DOUBLE, MYSQL_TYPE_DECIMAL, MYSQL_TYPE_NEWDECIMAL:
+		return true
+	}
+	return false
+}
+
+func (this *Column) isCharacter() bool {
+	switch this.RealType() {
+	case MYSQL_TYPE_STRING, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_VARCHAR,
+		MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB:
+		return true
+	}
+	return false
+}
+
+// 解析空值位图之后的可选元数据, 每一项为 类型(1字节) + 长度(变长整数) + 内容
+func (this *TableMapLogEvent) decodeOptionalMetadata(logbuf *LogBuffer) {
+	metadata := new(TableMapMetadata)
+	metadata.Unsigned = make([]bool, this.ColumnCnt)
+	metadata.Charsets = make([]int, this.ColumnCnt)
+	metadata.EnumValues = make([][]string, this.ColumnCnt)
+	metadata.SetValues = make([][]string, this.ColumnCnt)
+
+	for logbuf.GetRestLen() > 0 {
+		fieldType := logbuf.GetUInt8()
+		length, err := logbuf.GetVarLen()
+		if nil != err || int(length) > logbuf.GetRestLen() {
+			break
+		}
+		field := NewLogBuffer(logbuf.GetVarLenBytes(int(length)))
+
+		switch fieldType {
+		case TABLE_MAP_SIGNEDNESS:
+			this.decodeSignedness(field, metadata)
+		case TABLE_MAP_DEFAULT_CHARSET:
+			this.decodeDefaultCharset(field, metadata, (*Column).isCharacter)
+		case TABLE_MAP_COLUMN_CHARSET:
+			this.decodeColumnCharset(field, metadata, (*Column).isCharacter)
+		case TABLE_MAP_ENUM_AND_SET_DEFAULT_CHARSET:
+			this.decodeDefaultCharset(field, metadata, isEnumOrSet)
+		case TABLE_MAP_ENUM_AND_SET_COLUMN_CHARSET:
+			this.decodeColumnCharset(field, metadata, isEnumOrSet)
+		case TABLE_MAP_COLUMN_NAME:
+			for field.GetRestLen() > 0 {
+				nameLen, _ := field.GetVarLen()
+				metadata.ColumnNames = append(metadata.ColumnNames, field.GetVarLenString(int(nameLen)))
+			}
+		case TABLE_MAP_SET_STR_VALUE:
+			this.decodeStrValues(field, metadata.SetValues, MYSQL_TYPE_SET)
+		case TABLE_MAP_ENUM_STR_VALUE:
+			this.decodeStrValues(field, metadata.EnumValues, MYSQL_TYPE_ENUM)
+		case TABLE_MAP_SIMPLE_PRIMARY_KEY:
+			for field.GetRestLen() > 0 {
+				index, _ := field.GetVarLen()
+				metadata.PrimaryKeys = append(metadata.PrimaryKeys, int(index))
+			}
+		case TABLE_MAP_PRIMARY_KEY_WITH_PREFIX:
+			for field.GetRestLen() > 0 {
+				index, _ := field.GetVarLen()
+				field.GetVarLen() // 前缀长度
+				metadata.PrimaryKeys = append(metadata.PrimaryKeys, int(index))
+			}
+		}
+	}
+
+	this.Metadata = metadata
+	if len(metadata.ColumnNames) == this.ColumnCnt {
+		this.TableMeta = this.buildTableMeta()
+	}
+}
+
+// 每个数字列一位, 从高位开始, 1表示unsigned
+func (this *TableMapLogEvent) decodeSignedness(field *LogBuffer, metadata *TableMapMetadata) {
+	bitmap := field.GetRestBytes()
+	index := 0
+	for i, column := range this.ColumnInfo {
+		if !column.isNumeric() {
+			continue
+		}
+		if index/8 < len(bitmap) {
+			metadata.Unsigned[i] = bitmap[index/8]&(0x80>>uint(index%8)) != 0
+		}
+		index++
+	}
+}
+
+// 默认字符集, 之后是与默认字符集不同的列: 列序号(在同类列中的序号) + 字符集
+func (this *TableMapLogEvent) decodeDefaultCharset(field *LogBuffer, metadata *TableMapMetadata, match func(*Column) bool) {
+	defaultCharset, _ := field.GetVarLen()
+	columns := this.matchColumns(match)
+	for _, i := range columns {
+		metadata.Charsets[i] = int(defaultCharset)
+	}
+
+	for field.GetRestLen() > 0 {
+		index, _ := field.GetVarLen()
+		charset, _ := field.GetVarLen()
+		if int(index) < len(columns) {
+			metadata.Charsets[columns[index]] = int(charset)
+		}
+	}
+}
+
+// 每个同类列一个字符集
+func (this *TableMapLogEvent) decodeColumnCharset(field *LogBuffer, metadata *TableMapMetadata, match func(*Column) bool) {
+	for _, i := range this.matchColumns(match) {
+		if field.GetRestLen() == 0 {
+			break
+		}
+		charset, _ := field.GetVarLen()
+		metadata.Charsets[i] = int(charset)
+	}
+}
+
+// 每个ENUM或SET列: 取值个数 + 每个取值(长度 + 字符串)
+func (this *TableMapLogEvent) decodeStrValues(field *LogBuffer, values [][]string, columnType byte) {
+	for i, column := range this.ColumnInfo {
+		if column.RealType() != columnType || field.GetRestLen() == 0 {
+			continue
+		}
+
+		count, _ := field.GetVarLen()
+		values[i] = make([]string, 0, count)
+		for j := uint64(0); j < count; j++ {
+			valueLen, _ := field.GetVarLen()
+			values[i] = append(values[i], field.GetVarLenString(int(valueLen)))
+		}
+	}
+}
+
+func (this *TableMapLogEvent) matchColumns(match func(*Column) bool) []int {
+	columns := make([]int, 0, this.ColumnCnt)
+	for i, column := range this.ColumnInfo {
+		if match(column) {
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
+
+func isEnumOrSet(column *Column) bool {
+	realType := column.RealType()
+	return realType == MYSQL_TYPE_ENUM || realType == MYSQL_TYPE_SET
+}
+
+// 用元数据生成与desc结果格式相同的表结构
+func (this *TableMapLogEvent) buildTableMeta() *TableMeta {
+	fields := make([]*FieldMeta, 0, this.ColumnCnt)
+	for i, column := range this.ColumnInfo {
+		field := new(FieldMeta)
+		field.ColumnName = this.Metadata.ColumnNames[i]
+		field.ColumnType = this.columnTypeName(i, column)
+		field.IsNullable = "NO"
+		if nil != this.NullBitset && IsNull(this.NullBitset, i) {
+			field.IsNullable = "YES"
+		}
+		fields = append(fields, field)
+	}
+
+	for _, index := range this.Metadata.PrimaryKeys {
+		if index < len(fields) {
+			fields[index].IsKey = "PRI"
+		}
+	}
+
+	return NewTableMeta(this.DbName+"."+this.TblName, fields)
+}
+
+func (this *TableMapLogEvent) columnTypeName(i int, column *Column) string {
+	binary := this.Metadata.Charsets[i] == BINARY_CHARSET_ID
+
+	typeName := ""
+	switch column.RealType() {
+	case MYSQL_TYPE_TINY:
+		typeName = "tinyint"
+	case MYSQL_TYPE_SHORT:
+		typeName = "smallint"
+	case MYSQL_TYPE_INT24:
+		typeName = "mediumint"
+	case MYSQL_TYPE_LONG:
+		typeName = "int"
+	case MYSQL_TYPE_LONGLONG:
+		typeName = "bigint"
+	case MYSQL_TYPE_FLOAT:
+		typeName = "float"
+	case MYSQL_TYPE_DOUBLE:
+		typeName = "double"
+	case MYSQL_TYPE_NEWDECIMAL, MYSQL_TYPE_DECIMAL:
+		typeName = fmt.Sprintf("decimal(%d,%d)", column.ColumnMeta>>8, column.ColumnMeta&0xff)
+	case MYSQL_TYPE_YEAR:
+		typeName = "year"
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_NEWDATE:
+		typeName = "date"
+	case MYSQL_TYPE_TIME, MYSQL_TYPE_TIME2:
+		typeName = "time"
+	case MYSQL_TYPE_DATETIME, MYSQL_TYPE_DATETIME2:
+		typeName = "datetime"
+	case MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIMESTAMP2:
+		typeName = "timestamp"
+	case MYSQL_TYPE_BIT:
+		typeName = "bit"
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING:
+		typeName = "varchar"
+		if binary {
+			typeName = "varbinary"
+		}
+	case MYSQL_TYPE_STRING:
+		typeName = "char"
+		if binary {
+			typeName = "binary"
+		}
+	case MYSQL_TYPE_BLOB, MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB:
+		//meta为长度字段的字节数
+		prefix := map[int]string{1: "tiny", 3: "medium", 4: "long"}[column.ColumnMeta]
+		if binary {
+			typeName = prefix + "blob"
+		} else {
+			typeName = prefix + "text"
+		}
+	case MYSQL_TYPE_ENUM:
+		typeName = "enum(" + quoteValues(this.Metadata.EnumValues[i]) + ")"
+	case MYSQL_TYPE_SET:
+		typeName = "set(" + quoteValues(this.Metadata.SetValues[i]) + ")"
+	case MYSQL_TYPE_GEOMETRY:
+		typeName = "geometry"
+	case MYSQL_TYPE_JSON:
+		typeName = "json"
+	default:
+		typeName = fmt.Sprintf("type%d", column.RealType())
+	}
+
+	if this.Metadata.Unsigned[i] {
+		typeName += " unsigned"
+	}
+	return typeName
+}
+
+func quoteValues(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, "'"+strings.Replace(value, "'", "''", -1)+"'")
+	}
+	return strings.Join(quoted, ",")
+}
@@ -10,12 +10,13 @@ type TableMeta struct {
 }
 
 type FieldMeta struct {
-	ColumnName   string
-	ColumnType   string
-	IsNullable   string
-	IsKey        string
-	DefaultValue string
-	Extra        string
+	ColumnName   string `json:"name"`
+	ColumnType   string `json:"type"`
+	IsNullable   string `json:"nullable"`
+	IsKey        string `json:"key"`
+	DefaultValue string `json:"default"`
+	Extra        string `json:"extra"`
+	Collation    string `json:"collation,omitempty"` // 字符列的排序规则, 用于转换字符集
 }
 
 func NewTableMeta(fullName string, fields []*FieldMeta) *TableMeta {
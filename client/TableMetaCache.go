@@ -1,10 +1,19 @@
 package client
 
-import "github.com/SDHM/sqlregret/mysql"
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/SDHM/sqlregret/mysql"
+	"github.com/cihub/seelog"
+)
 
 type TableMetaCache struct {
 	reader            IBinlogReader
 	tableMetaCacheMap map[string]*TableMeta
+	lock              sync.Mutex     // 并行解析时多个文件共用一个连接查询表结构
+	history           *SchemaHistory // 从快照加载时记录DDL之后的表结构
 }
 
 func NewTableMetaCache(reader IBinlogReader) *TableMetaCache {
@@ -15,29 +24,66 @@ func NewTableMetaCache(reader IBinlogReader) *TableMetaCache {
 }
 
 func (this *TableMetaCache) getTableMeta(fullName string, flush bool) *TableMeta {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	//从快照加载时没有数据库连接, 只能使用快照以及之后DDL修改的表结构
+	if nil != this.history {
+		return this.history.Latest(fullName)
+	}
+	if nil == this.reader {
+		return this.tableMetaCacheMap[fullName]
+	}
 
 	if flush {
-		if rst, err := this.reader.Query("desc " + fullName); nil != err {
-			return nil
-		} else {
-			this.tableMetaCacheMap[fullName] = this.parserTableMeta(rst, fullName)
-			return this.tableMetaCacheMap[fullName]
-		}
+		return this.queryTableMeta(fullName)
 	}
 
 	v, ok := this.tableMetaCacheMap[fullName]
 	if !ok {
-		if rst, err := this.reader.Query("desc " + fullName); nil != err {
-			return nil
-		} else {
-			this.tableMetaCacheMap[fullName] = this.parserTableMeta(rst, fullName)
-			return this.tableMetaCacheMap[fullName]
-		}
+		return this.queryTableMeta(fullName)
 	} else {
 		return v
 	}
 }
 
+func (this *TableMetaCache) queryTableMeta(fullName string) *TableMeta {
+	rst, err := this.reader.Query("desc " + fullName)
+	if nil != err {
+		return nil
+	}
+
+	tableMeta := this.parserTableMeta(rst, fullName)
+	this.fillCollations(tableMeta, fullName)
+	this.tableMetaCacheMap[fullName] = tableMeta
+	return tableMeta
+}
+
+// desc中没有字符集, 从information_schema获取字符列的排序规则, 失败时按UTF-8处理
+func (this *TableMetaCache) fillCollations(tableMeta *TableMeta, fullName string) {
+	names := strings.SplitN(fullName, ".", 2)
+	if len(names) != 2 {
+		return
+	}
+
+	sql := fmt.Sprintf("select column_name, collation_name from information_schema.columns"+
+		" where table_schema = '%s' and table_name = '%s' and collation_name is not null",
+		mysql.Escape(names[0]), mysql.Escape(names[1]))
+	rst, err := this.reader.Query(sql)
+	if nil != err {
+		seelog.Warnf("获取表%s的字符集失败:%s", fullName, err.Error())
+		return
+	}
+
+	for i := 0; i < rst.RowNumber(); i++ {
+		columnName, _ := rst.GetString(i, 0)
+		collation, _ := rst.GetString(i, 1)
+		if index := findField(tableMeta.Fileds, columnName); index >= 0 {
+			tableMeta.Fileds[index].Collation = collation
+		}
+	}
+}
+
 func (this *TableMetaCache) parserTableMeta(rst *mysql.Result, fullName string) *TableMeta {
 
 	fieldMetas := make([]*FieldMeta, 0)
@@ -72,3 +118,19 @@ func (this *TableMetaCache) parserTableMeta(rst *mysql.Result, fullName string)
 
 	return NewTableMeta(fullName, fieldMetas)
 }
+
+// 把DDL应用到表结构历史上, 没有表结构历史时(从数据库获取表结构)不处理
+func (this *TableMetaCache) ApplyDDL(schema string, sql string, fileIndex int, pos int64) bool {
+	if nil == this.history {
+		return false
+	}
+	return this.history.Apply(schema, sql, fileIndex, pos)
+}
+
+// 位置上生效的表结构, 没有表结构历史时返回空
+func (this *TableMetaCache) GetTableMetaAt(fullName string, fileIndex int, pos int64) *TableMeta {
+	if nil == this.history {
+		return nil
+	}
+	return this.history.Lookup(fullName, fileIndex, pos)
+}
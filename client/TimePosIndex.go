@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+// mark模式记录的时间点, 位置为事务结束的位置
+type TimePos struct {
+	Time     time.Time
+	FileName string
+	Pos      int64
+	Gtid     string // 该位置之前最后一个事务的GTID, 没有时为空
+}
+
+// 时间点与binlog位置的索引, 每个server一个文件, 每行一个记录:
+// 时间戳\t文件名\t位置\tGTID
+type TimePosIndex struct {
+	path     string
+	interval time.Duration // 两个记录之间的最小时间间隔
+	marks    []*TimePos    // 按时间排序
+}
+
+func NewTimePosIndex(path string, interval time.Duration) *TimePosIndex {
+	this := new(TimePosIndex)
+	this.path = path
+	this.interval = interval
+	this.marks = make([]*TimePos, 0)
+	return this
+}
+
+// 读取索引文件, 文件不存在时索引为空
+func (this *TimePosIndex) Load() error {
+	f, err := os.Open(this.path)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	this.marks = make([]*TimePos, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			seelog.Warnf("忽略无效的时间点记录:%s", line)
+			continue
+		}
+
+		timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+		if nil != err {
+			seelog.Warnf("忽略无效的时间点记录:%s", line)
+			continue
+		}
+
+		pos, err := strconv.ParseInt(fields[2], 10, 64)
+		if nil != err {
+			seelog.Warnf("忽略无效的时间点记录:%s", line)
+			continue
+		}
+
+		mark := &TimePos{Time: time.Unix(timestamp, 0), FileName: fields[1], Pos: pos}
+		if len(fields) > 3 {
+			mark.Gtid = fields[3]
+		}
+		this.marks = append(this.marks, mark)
+	}
+
+	sort.SliceStable(this.marks, func(i, j int) bool {
+		return this.marks[i].Time.Before(this.marks[j].Time)
+	})
+	return scanner.Err()
+}
+
+// 记录一个时间点, 与已有记录的时间间隔小于interval时忽略
+// 重复mark同一段binlog时不会产生重复记录
+func (this *TimePosIndex) Add(t time.Time, fileName string, pos int64, gtid string) error {
+	index := sort.Search(len(this.marks), func(i int) bool {
+		return !this.marks[i].Time.Before(t)
+	})
+
+	if index < len(this.marks) && this.marks[index].Time.Sub(t) < this.interval {
+		return nil
+	}
+	if index > 0 && t.Sub(this.marks[index-1].Time) < this.interval {
+		return nil
+	}
+
+	f, err := os.OpenFile(this.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%d\t%s\t%d\t%s\n", t.Unix(), fileName, pos, gtid); nil != err {
+		return err
+	}
+
+	mark := &TimePos{Time: t, FileName: fileName, Pos: pos, Gtid: gtid}
+	this.marks = append(this.marks, nil)
+	copy(this.marks[index+1:], this.marks[index:])
+	this.marks[index] = mark
+	return nil
+}
+
+// 查找早于t的最后一个记录, 从该位置开始解析不会漏掉t之后的事件
+func (this *TimePosIndex) Lookup(t time.Time) *TimePos {
+	index := sort.Search(len(this.marks), func(i int) bool {
+		return !this.marks[i].Time.Before(t)
+	})
+
+	if index == 0 {
+		return nil
+	}
+	return this.marks[index-1]
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimePosIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "127.0.0.1_3306.mark")
+	base := time.Unix(1488852000, 0)
+
+	index := NewTimePosIndex(path, time.Second*10)
+	index.Add(base, "mysql-bin.000001", 120, "")
+	index.Add(base.Add(time.Second*5), "mysql-bin.000001", 500, "") // 间隔太短, 忽略
+	index.Add(base.Add(time.Second*30), "mysql-bin.000002", 300, "3e11fa47-71ca-11e1-9e33-c80aa9429562:23")
+	index.Add(base.Add(time.Second*15), "mysql-bin.000001", 900, "") // 补充之前的时间点
+
+	loaded := NewTimePosIndex(path, time.Second*10)
+	if err := loaded.Load(); nil != err {
+		t.Fatal(err)
+	}
+	if len(loaded.marks) != 3 {
+		t.Fatalf("got %d marks", len(loaded.marks))
+	}
+
+	if mark := loaded.Lookup(base); nil != mark {
+		t.Fatalf("no mark before %v, got %v", base, mark)
+	}
+
+	if mark := loaded.Lookup(base.Add(time.Second * 20)); nil == mark || mark.Pos != 900 {
+		t.Fatalf("got %v", mark)
+	}
+
+	mark := loaded.Lookup(base.Add(time.Minute))
+	if nil == mark || mark.FileName != "mysql-bin.000002" || mark.Pos != 300 ||
+		mark.Gtid != "3e11fa47-71ca-11e1-9e33-c80aa9429562:23" {
+		t.Fatalf("got %v", mark)
+	}
+}
@@ -2,10 +2,12 @@ package client
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"time"
 
+	"github.com/SDHM/sqlregret/binlogevent"
 	"github.com/SDHM/sqlregret/config"
 )
 
@@ -21,7 +23,12 @@ type Transaction struct {
 	sqlArray   []*ShowSql // sql语句数组
 	sqlCount   int        // 事务事件总数
 	xid        int64      // 事务id号
-	outputFile *os.File
+	gtid       string     // 事务的GTID
+	gtidDetail string     // 输出的GTID信息
+	sid        []byte     // GTID中的server_uuid
+	gno        int64      // GTID中的序号
+	outputFile io.Writer
+	console    io.Writer // 提示信息的输出, 默认为标准输出
 }
 
 type ShowSql struct {
@@ -67,9 +74,33 @@ func NewTransaction(filename string) *Transaction {
 		}
 	}
 
+	this.console = os.Stdout
+
+	return this
+}
+
+// 输出到指定的writer, 并行解析时每个文件先输出到各自的缓冲区
+func NewBufferTransaction(output io.Writer, console io.Writer) *Transaction {
+	this := new(Transaction)
+	this.outputFile = output
+	this.console = console
 	return this
 }
 
+// 提示信息与事务是否输出到同一个地方(如都是标准输出)
+func (this *Transaction) SharedConsole() bool {
+	return this.console == this.outputFile
+}
+
+// 输出提示信息(如DDL语句)
+func (this *Transaction) Printf(format string, a ...interface{}) {
+	if nil == this.console {
+		fmt.Printf(format, a...)
+		return
+	}
+	fmt.Fprintf(this.console, format, a...)
+}
+
 func checkFileIsExist(filename string) bool {
 	var exist = true
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
@@ -89,6 +120,33 @@ func (this *Transaction) Begin(beginTime string, file string, pos int64) {
 	this.sqlArray = make([]*ShowSql, 0, 2)
 }
 
+// 设置事务的GTID, GTID事件在BEGIN之前
+func (this *Transaction) SetGtid(gtidEvent *binlogevent.Gtid_event) {
+	this.gtid = gtidEvent.String()
+	this.gtidDetail = fmt.Sprintf("GTID:%s\tlast_committed:%d\tsequence_number:%d", this.gtid, gtidEvent.LastCommitted, gtidEvent.SequenceNumber)
+	this.sid = gtidEvent.SID
+	this.gno = gtidEvent.GNO
+}
+
+// 设置MariaDB事务的GTID
+func (this *Transaction) SetMariadbGtid(gtidEvent *binlogevent.Mariadb_Gtid_event) {
+	this.gtid = gtidEvent.String()
+	this.gtidDetail = fmt.Sprintf("GTID:%s\tcommit_id:%d", this.gtid, gtidEvent.CommitId)
+	this.sid = nil
+	this.gno = 0
+}
+
+func (this *Transaction) GetGtid() string {
+	return this.gtid
+}
+
+func (this *Transaction) clearGtid() {
+	this.gtid = ""
+	this.gtidDetail = ""
+	this.sid = nil
+	this.gno = 0
+}
+
 func (this *Transaction) End(xid int64) {
 	this.withEnd = true
 	this.xid = xid
@@ -125,6 +183,31 @@ func (this *Transaction) PrintTransaction() {
 	this.output(this.withBegin && this.withEnd)
 	this.withBegin = false
 	this.beSkip = false
+	this.clearGtid()
+}
+
+// 输出还没有结束的事务(如读取到末尾时)
+func (this *Transaction) Flush() {
+	if this.withBegin && !this.withEnd {
+		this.PrintTransaction()
+	}
+}
+
+// 丢弃未完成的事务, 重连之后会从上一个完整事务之后重新解析
+func (this *Transaction) Discard() {
+	this.withBegin = false
+	this.withEnd = false
+	this.beSkip = false
+	this.sqlCount = 0
+	this.sqlArray = nil
+	this.beginTime = nil
+	this.endTime = nil
+	this.clearGtid()
+}
+
+// 当前事务的GTID, 没有GTID时sid为nil
+func (this *Transaction) GetGtidNo() ([]byte, int64) {
+	return this.sid, this.gno
 }
 
 func (this *Transaction) IsTransactionEnd() bool {
@@ -136,13 +219,25 @@ func (this *Transaction) SkipSomeThing() {
 	this.beSkip = true
 }
 
+// 当前事务(或DDL)的GTID是否在--gtid指定的集合中, 没有指定时都匹配
+func (this *Transaction) MatchGtid() bool {
+	return nil == config.G_filterConfig.GtidSet || config.G_filterConfig.GtidSet.Contain(this.sid, this.gno)
+}
+
 func (this *Transaction) output(full bool) {
+	if !this.MatchGtid() {
+		this.sqlArray = nil
+		this.beginTime = nil
+		this.endTime = nil
+		return
+	}
+
 	if config.G_filterConfig.Xid == 0 {
 		this.oneTransactionOutPut(full)
 	} else {
 		if config.G_filterConfig.Xid == this.xid {
 			this.oneTransactionOutPut(full)
-			this.outputFile.WriteString("事务解析完毕\n")
+			io.WriteString(this.outputFile, "事务解析完毕\n")
 			os.Exit(1)
 		}
 	}
@@ -163,13 +258,19 @@ func (this *Transaction) oneTransactionOutPut(full bool) {
 
 	effectorRow := this.sqlCount / 4
 	if config.G_filterConfig.Mode == "pre" && effectorRow > config.G_filterConfig.Limit {
-		str := fmt.Sprintf("事务文件:%s\t事务偏移:%d\t事务影响行数:%d\t事务ID:%d\n", this.binlogFile, this.offset, effectorRow, this.xid)
-		this.outputFile.WriteString(str)
+		str := fmt.Sprintf("事务文件:%s\t事务偏移:%d\t事务影响行数:%d\t事务ID:%d", this.binlogFile, this.offset, effectorRow, this.xid)
+		if this.gtid != "" {
+			str += fmt.Sprintf("\tGTID:%s", this.gtid)
+		}
+		io.WriteString(this.outputFile, str+"\n")
 		return
 	}
 
 	if len(this.sqlArray) > 0 && !config.G_filterConfig.Dump {
 		str := fmt.Sprintf("\n事务开始\n")
+		if this.gtid != "" {
+			str += this.gtidDetail + "\n"
+		}
 		this.WriteAll(str)
 	}
 
@@ -222,7 +323,7 @@ func (this *Transaction) WriteAll(str string) {
 	length := len(str)
 	writeLen := 0
 	for writeLen != length {
-		if n, err := this.outputFile.WriteString(str[writeLen:]); nil != err {
+		if n, err := io.WriteString(this.outputFile, str[writeLen:]); nil != err {
 			return
 		} else {
 			writeLen += n
@@ -1,27 +1,33 @@
 package client
 
 import (
-	"fmt"
-
 	. "github.com/SDHM/sqlregret/binlogevent"
 	"github.com/SDHM/sqlregret/mysql"
 )
 
 type Previous_Gtids_Log_Event struct {
-	buf []byte
+	gtidSet *mysql.GtidSet
 }
 
-func ParsePreviousGtidLogEvent(logBuf *mysql.LogBuffer, descriptionEvent *FormatDescriptionLogEvent) *Previous_Gtids_Log_Event {
+func ParsePreviousGtidLogEvent(logBuf *mysql.LogBuffer, descriptionEvent *FormatDescriptionLogEvent) (*Previous_Gtids_Log_Event, error) {
 	// common_header_len := descriptionEvent.commonHeaderLen
 	post_header_len := descriptionEvent.PostHeaderLen[PREVIOUS_GTIDS_LOG_EVENT-1]
 
 	event := new(Previous_Gtids_Log_Event)
 	logBuf.SkipLen(int(post_header_len))
-	event.buf = logBuf.GetRestBytes()
-	return event
+
+	gtidSet, err := mysql.DecodeGtidSet(logBuf.GetRestBytes())
+	if nil != err {
+		return nil, err
+	}
+	event.gtidSet = gtidSet
+	return event, nil
+}
+
+func (this *Previous_Gtids_Log_Event) GetGtidSet() *mysql.GtidSet {
+	return this.gtidSet
 }
 
 func (this *Previous_Gtids_Log_Event) String() string {
-	fmt.Printf("% 2x", this.buf)
-	return ""
+	return this.gtidSet.String()
 }
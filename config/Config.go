@@ -1,7 +1,12 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/cihub/seelog"
 
@@ -9,19 +14,116 @@ import (
 )
 
 type Config struct {
-	Mode              string `json:"mode"` // online:实时同步 onfile:读取文件
-	Destination       string `json:"destination"`
-	SlaveId           int    `json:"slaveId"`
-	BasePath          string `json:"basePath"`
-	IndexFile         string `json:"indexFile"`
-	MasterAddress     string `json:"masterAddress"`
-	MasterPort        int    `json:"masterPort"`
-	MasterJournalName string `json:"masterJournalName"`
-	MasterPosition    int    `json:"masterPosition"`
-	DbUsername        string `json:"dbUsername"`
-	DbPassword        string `json:"dbPassword"`
-	DefaultDbName     string `json:"defaultDbName"`
-	LimitShowRow      int    `json:"limitShowRow"` // 在pre模式下，影响行数超过此值的予以显示
+	Mode              string   `json:"mode"` // online:实时同步 onfile:读取文件
+	Destination       string   `json:"destination"`
+	SlaveId           int      `json:"slaveId"`
+	BasePath          string   `json:"basePath"`
+	IndexFile         string   `json:"indexFile"`   // 为空时扫描basePath目录下的binlog文件
+	BinlogFiles       []string `json:"binlogFiles"` // 指定要解析的binlog文件, 按序号排序, 设置后忽略indexFile
+	MasterAddress     string   `json:"masterAddress"`
+	MasterPort        int      `json:"masterPort"`
+	MasterJournalName string   `json:"masterJournalName"`
+	MasterPosition    int      `json:"masterPosition"`
+	StartGtid         string   `json:"startGtid"` // 不为空时按GTID集合dump, 忽略masterJournalName与masterPosition
+	DbUsername        string   `json:"dbUsername"`
+	DbPassword        string   `json:"dbPassword"`
+	DefaultDbName     string   `json:"defaultDbName"`
+	LimitShowRow      int      `json:"limitShowRow"`    // 在pre模式下，影响行数超过此值的予以显示
+	HeartbeatPeriod   int      `json:"heartbeatPeriod"` // online模式下master发送心跳的间隔(秒), 默认10秒, 小于0表示不开启
+	ReadTimeout       int      `json:"readTimeout"`     // online模式下超过此时间(秒)没有收到事件或心跳则重连, 默认为心跳间隔的3倍
+	TlsMode           string   `json:"tlsMode"`         // TLS模式 disabled:不使用 preferred:服务端支持则使用 required:必须使用, 默认disabled
+	TlsCa             string   `json:"tlsCa"`           // CA证书, 设置后校验服务端证书
+	TlsCert           string   `json:"tlsCert"`         // 客户端证书
+	TlsKey            string   `json:"tlsKey"`          // 客户端私钥
+	TlsServerName     string   `json:"tlsServerName"`   // 校验服务端证书的主机名, 设置后校验服务端证书
+	ArchivePath       string   `json:"archivePath"`     // archive模式下保存binlog文件的目录, 默认当前目录
+	MarkFile          string   `json:"markFile"`        // mark模式保存时间点的索引文件, 默认为 masterAddress_masterPort.mark
+	Source            string   `json:"source"`          // 不为空时从该binlog数据流解析, -表示标准输入, 忽略mode
+}
+
+const (
+	TLS_MODE_DISABLED  = "disabled"
+	TLS_MODE_PREFERRED = "preferred"
+	TLS_MODE_REQUIRED  = "required"
+)
+
+// 默认心跳间隔(秒)
+const DEFAULT_HEARTBEAT_PERIOD = 10
+
+// 心跳间隔, 为0时表示不开启
+func (this *Config) GetHeartbeatPeriod() time.Duration {
+	if this.HeartbeatPeriod < 0 {
+		return 0
+	} else if this.HeartbeatPeriod == 0 {
+		return time.Duration(DEFAULT_HEARTBEAT_PERIOD) * time.Second
+	}
+	return time.Duration(this.HeartbeatPeriod) * time.Second
+}
+
+// TLS模式, 默认不使用TLS
+func (this *Config) GetTlsMode() (string, error) {
+	switch mode := strings.ToLower(this.TlsMode); mode {
+	case "":
+		return TLS_MODE_DISABLED, nil
+	case TLS_MODE_DISABLED, TLS_MODE_PREFERRED, TLS_MODE_REQUIRED:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("tlsMode必须为disabled、preferred、required:%s", this.TlsMode)
+	}
+}
+
+// 根据配置生成TLS配置, 没有设置CA与主机名时不校验服务端证书
+func (this *Config) GetTlsConfig() (*tls.Config, error) {
+	tlsConfig := new(tls.Config)
+
+	if this.TlsCa != "" {
+		pem, err := ioutil.ReadFile(this.TlsCa)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("无法解析CA证书:%s", this.TlsCa)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if this.TlsCert != "" || this.TlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(this.TlsCert, this.TlsKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if this.TlsServerName != "" {
+		tlsConfig.ServerName = this.TlsServerName
+	} else if this.TlsCa != "" {
+		tlsConfig.ServerName = this.MasterAddress
+	} else {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
+
+// 读超时时间, 为0时表示不检测
+func (this *Config) GetReadTimeout() time.Duration {
+	if this.ReadTimeout > 0 {
+		return time.Duration(this.ReadTimeout) * time.Second
+	}
+	return this.GetHeartbeatPeriod() * 3
+}
+
+// 时间点索引文件, 每个server一个
+func (this *Config) GetMarkFile() string {
+	if this.MarkFile != "" {
+		return this.MarkFile
+	}
+
+	address := strings.NewReplacer("/", "_", ":", "_").Replace(this.MasterAddress)
+	return fmt.Sprintf("%s_%d.mark", address, this.MasterPort)
 }
 
 func ParseConfigData(data []byte) (*Config, error) {
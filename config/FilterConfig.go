@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/SDHM/sqlregret/mysql"
 )
 
 //过滤配置
@@ -24,6 +26,7 @@ type FilterConfig struct {
 	Mode                   string          // 运行模式 parse:解析模式  mark:记录时间点模式
 	NeedReverse            bool            // 是否需要反向操作语句
 	WithDDL                bool            // 是否解析DDL语句 true:解析 false:不解析
+	DDLTypes               map[string]bool // 输出的DDL类型(protocol.EventType的名称), 为空时输出所有类型
 	InsertFilterColumn     []*ColumnFilter // 插入操作列过滤器
 	withInsertFilterColumn bool            // 是否有插入操作的列过滤器
 	UpdateFilterColumn     []*ColumnFilter // 更新操作列过滤器
@@ -32,7 +35,14 @@ type FilterConfig struct {
 	Origin                 bool            // 是否解析原始语句
 	Limit                  int             // pre 模式下影响行数超过此值的予以显示
 	Xid                    int64           // 单个事务解析
+	GtidSet                *mysql.GtidSet  // 按GTID或GTID范围解析事务
 	BigTime                int             // 单个事务耗费时间过滤
+	OnCorrupt              string          // 事件校验失败时的处理 fail:停止 skip:跳过 warn:告警
+	NonBlock               bool            // online模式下读取到master当前末尾时结束
+	MarkInterval           int             // mark模式下保存时间点的间隔(秒)
+	Parallel               int             // onfile模式下同时解析的文件数
+	SchemaFile             string          // 表结构快照文件, schema模式下导出, 其他模式下从中读取表结构
+	Geometry               string          // GEOMETRY列的输出格式 wkt:ST_GeomFromText hex:ST_GeomFromWKB
 }
 
 type ColumnFilter struct {
@@ -131,6 +141,11 @@ func (this *FilterConfig) AppendUpdateFilterColumn(filter *ColumnFilter) {
 	this.withUpdateFilterColumn = true
 }
 
+// 是否输出该类型的DDL语句
+func (this *FilterConfig) WithDDLType(eventType string) bool {
+	return this.WithDDL && (len(this.DDLTypes) == 0 || this.DDLTypes[eventType])
+}
+
 func (this *FilterConfig) WithInsertFilterColumn() bool {
 	return this.withInsertFilterColumn
 }
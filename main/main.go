@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"runtime"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -14,6 +13,8 @@ import (
 	"github.com/SDHM/sqlregret/client"
 	"github.com/SDHM/sqlregret/config"
 	"github.com/SDHM/sqlregret/instance"
+	"github.com/SDHM/sqlregret/mysql"
+	"github.com/SDHM/sqlregret/protocol"
 	"github.com/cihub/seelog"
 )
 
@@ -28,18 +29,27 @@ var (
 	endFile              = flag.String("end-file", "", "结束日志文件")
 	startPos             = flag.Int("start-pos", 0, "日志解析起点")
 	endPos               = flag.Int("end-pos", 0, "日志解析终点")
+	startGtid            = flag.String("start-gtid", "", "按GTID集合开始dump(online模式) 如 uuid:1-100,uuid2:1-20")
 	startTime            = flag.String("start-time", "", "日志解析开始时间点")
 	endTime              = flag.String("end-time", "", "日志解析结束时间点")
-	mode                 = flag.String("mode", "mark", "运行模式 parse:解析模式  mark:记录时间点模式  pre:预解析模式 可统计事务的记录条数 bigt:大事务解析")
+	mode                 = flag.String("mode", "mark", "运行模式 parse:解析模式  mark:记录时间点模式  pre:预解析模式 可统计事务的记录条数 bigt:大事务解析 archive:把master的binlog保存到本地 schema:导出表结构快照")
 	needReverse          = flag.Bool("rsv", true, "是否需要反向操作语句")
-	withDDL              = flag.Bool("with-ddl", false, "是否解析ddl语句")
+	withDDL              = newDDLFlag("with-ddl", "是否解析ddl语句 不带值或true:输出所有DDL 也可以指定输出的类型 如 --with-ddl=drop,truncate,rename (create alter drop truncate rename cindex dindex query)")
 	filterColumn         = flag.String("filter-column", "", "update(字段|改动前|改动后,字段|改动前|改动后) insert (字段|改动后) insert 与 update 用:连接 ")
 	dump                 = flag.Bool("dump", false, "是否要dump，dump的话，只输出反向语句")
 	origin               = flag.Bool("origin", false, "是否解析原始语句")
 	limitShowRow         = flag.Int("limit", 2, "pre模式下影响行数超过此值的予以显示")
 	output               = flag.String("output", "stdout", "结果生成文件")
 	xid                  = flag.Int64("xid", 0, "单个事务解析")
+	gtid                 = flag.String("gtid", "", "按GTID或GTID范围解析事务 如 uuid:5 或 uuid:1-10, 不支持MariaDB")
 	bigTime              = flag.Int("bigtime", 60, "大事务持续时间过滤")
+	nonBlock             = flag.Bool("non-block", false, "online模式下读取到master当前末尾时结束, 不再等待新的事件")
+	onCorrupt            = flag.String("on-corrupt", "fail", "事件CRC32校验失败时的处理 fail:停止解析 skip:跳过该事件 warn:告警并继续解析")
+	markInterval         = flag.Int("mark-interval", 10, "mark模式下保存时间点的间隔(秒)")
+	parallel             = flag.Int("parallel", 1, "onfile模式下同时解析的文件数, 按文件顺序输出")
+	source               = flag.String("source", "", "从binlog数据流解析, -表示标准输入 如 cat mysql-bin.000042 | sqlregret --mode=parse --source=-")
+	schemaFile           = flag.String("schema-file", "", "表结构快照文件 schema模式下导出到此文件, 其他模式下从此文件读取表结构而不连接数据库")
+	geometry             = flag.String("geometry", "wkt", "GEOMETRY列的输出格式 wkt:ST_GeomFromText('POINT(1 2)', srid) hex:ST_GeomFromWKB(X'..', srid)")
 )
 
 func main() {
@@ -100,6 +110,54 @@ func initLogger(cfgPath string) error {
 	return nil
 }
 
+// --with-ddl, 兼容原来的布尔参数, 也可以指定输出的DDL类型
+type ddlFlag struct {
+	enable bool
+	types  map[string]bool
+}
+
+func newDDLFlag(name string, usage string) *ddlFlag {
+	this := new(ddlFlag)
+	flag.Var(this, name, usage)
+	return this
+}
+
+func (this *ddlFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (this *ddlFlag) String() string {
+	if nil == this || !this.enable {
+		return "false"
+	}
+	return "true"
+}
+
+func (this *ddlFlag) Set(value string) error {
+	this.enable, this.types = false, nil
+	switch strings.ToLower(value) {
+	case "false", "":
+		return nil
+	case "true", "all":
+		this.enable = true
+		return nil
+	}
+
+	this.enable = true
+	this.types = make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "DROP" {
+			name = "ERASE"
+		}
+		if _, ok := protocol.EventType_value[name]; !ok || name == "INSERT" || name == "UPDATE" || name == "DELETE" {
+			return fmt.Errorf("不支持的DDL类型:%s", name)
+		}
+		this.types[name] = true
+	}
+	return nil
+}
+
 func ConfigCheck(cfg *config.Config) {
 
 	//打印帮助
@@ -115,8 +173,8 @@ func ConfigCheck(cfg *config.Config) {
 	}
 
 	config.G_filterConfig.Mode = strings.ToLower(*mode)
-	if config.G_filterConfig.Mode != "mark" && config.G_filterConfig.Mode != "parse" && config.G_filterConfig.Mode != "pre" && config.G_filterConfig.Mode != "bigt" {
-		fmt.Println("mode必须为mark、parse、pre、bigt")
+	if config.G_filterConfig.Mode != "mark" && config.G_filterConfig.Mode != "parse" && config.G_filterConfig.Mode != "pre" && config.G_filterConfig.Mode != "bigt" && config.G_filterConfig.Mode != "archive" && config.G_filterConfig.Mode != "schema" {
+		fmt.Println("mode必须为mark、parse、pre、bigt、archive、schema")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -126,6 +184,14 @@ func ConfigCheck(cfg *config.Config) {
 	config.G_filterConfig.Origin = *origin
 	config.G_filterConfig.Limit = *limitShowRow
 	config.G_filterConfig.Xid = *xid
+	if *gtid != "" {
+		if gtidSet, err := mysql.ParseGtidSet(*gtid); nil != err {
+			fmt.Println("请检查您的GTID过滤条件:", err.Error())
+			os.Exit(1)
+		} else {
+			config.G_filterConfig.GtidSet = gtidSet
+		}
+	}
 	config.G_filterConfig.FilterSQL = strings.ToLower(*filterSQL)
 	if config.G_filterConfig.FilterSQL != "update" &&
 		config.G_filterConfig.FilterSQL != "delete" &&
@@ -136,7 +202,48 @@ func ConfigCheck(cfg *config.Config) {
 		os.Exit(1)
 	}
 
-	config.G_filterConfig.WithDDL = *withDDL
+	config.G_filterConfig.OnCorrupt = strings.ToLower(*onCorrupt)
+	if config.G_filterConfig.OnCorrupt != client.CORRUPT_FAIL &&
+		config.G_filterConfig.OnCorrupt != client.CORRUPT_SKIP &&
+		config.G_filterConfig.OnCorrupt != client.CORRUPT_WARN {
+		fmt.Println("on-corrupt必须为fail、skip、warn")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	config.G_filterConfig.NonBlock = *nonBlock
+
+	if *markInterval <= 0 {
+		fmt.Println("mark-interval必须大于0")
+		flag.Usage()
+		os.Exit(1)
+	}
+	config.G_filterConfig.MarkInterval = *markInterval
+
+	if *parallel <= 0 {
+		fmt.Println("parallel必须大于0")
+		flag.Usage()
+		os.Exit(1)
+	}
+	config.G_filterConfig.Parallel = *parallel
+
+	if config.G_filterConfig.Mode == "schema" && *schemaFile == "" {
+		fmt.Println("schema模式必须指定schema-file")
+		flag.Usage()
+		os.Exit(1)
+	}
+	config.G_filterConfig.SchemaFile = *schemaFile
+
+	config.G_filterConfig.Geometry = strings.ToLower(*geometry)
+	if config.G_filterConfig.Geometry != client.GEOMETRY_WKT &&
+		config.G_filterConfig.Geometry != client.GEOMETRY_HEX {
+		fmt.Println("geometry必须为wkt、hex")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	config.G_filterConfig.WithDDL = withDDL.enable
+	config.G_filterConfig.DDLTypes = withDDL.types
 	config.G_filterConfig.Dump = *dump
 
 	if *filterColumn != "" {
@@ -201,7 +308,11 @@ func ConfigCheck(cfg *config.Config) {
 
 	//检查开始时间与开始位置
 	if *startFile != "" && *startPos != 0 {
-		fileIndex, _ := strconv.Atoi(strings.Split(*startFile, ".")[1])
+		fileIndex, err := client.BinlogFileIndex(*startFile)
+		if nil != err {
+			fmt.Println("请检查您的开始文件:", err.Error())
+			os.Exit(1)
+		}
 		config.G_filterConfig.SetStartPos(fileIndex, *startPos)
 		cfg.MasterJournalName = *startFile
 		cfg.MasterPosition = *startPos
@@ -214,7 +325,11 @@ func ConfigCheck(cfg *config.Config) {
 
 	//检查结束文件与结束位置
 	if *endFile != "" && *endPos != 0 {
-		fileIndex, _ := strconv.Atoi(strings.Split(*endFile, ".")[1])
+		fileIndex, err := client.BinlogFileIndex(*endFile)
+		if nil != err {
+			fmt.Println("请检查您的结束文件:", err.Error())
+			os.Exit(1)
+		}
 		config.G_filterConfig.SetEndPos(fileIndex, *endPos)
 	} else if *endFile == "" && *endPos == 0 {
 
@@ -227,4 +342,33 @@ func ConfigCheck(cfg *config.Config) {
 		fmt.Println("指定了结束文件和位置必须同时指定开始文件和位置")
 		os.Exit(1)
 	}
+
+	//检查开始GTID集合
+	if *startGtid != "" {
+		if config.G_filterConfig.StartPosEnable() {
+			fmt.Println("开始GTID集合与开始文件位置不能同时设置")
+			os.Exit(1)
+		}
+
+		if _, err := mysql.ParseGtidSet(*startGtid); nil != err {
+			fmt.Println("请检查您的开始GTID集合:", err.Error())
+			os.Exit(1)
+		}
+		cfg.StartGtid = *startGtid
+	}
+
+	//检查binlog数据流, 数据流对应的文件名只能通过--start-file指定
+	if *source != "" {
+		if *startGtid != "" || config.G_filterConfig.Mode == "archive" {
+			fmt.Println("从数据流解析时不能设置开始GTID集合, 也不能使用archive模式")
+			os.Exit(1)
+		}
+
+		if !config.G_filterConfig.StartPosEnable() {
+			cfg.MasterJournalName = ""
+			cfg.MasterPosition = 4
+		}
+		cfg.StartGtid = ""
+		cfg.Source = *source
+	}
 }
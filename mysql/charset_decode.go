@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// MySQL字符集对应的编码, 不在其中的字符集(utf8、utf8mb4、ascii、binary等)不需要转换
+var charsetEncodings = map[string]encoding.Encoding{
+	"big5":     traditionalchinese.Big5,
+	"cp850":    charmap.CodePage850,
+	"koi8r":    charmap.KOI8R,
+	"latin1":   charmap.Windows1252, // MySQL的latin1实际为cp1252
+	"latin2":   charmap.ISO8859_2,
+	"ujis":     japanese.EUCJP,
+	"sjis":     japanese.ShiftJIS,
+	"hebrew":   charmap.ISO8859_8,
+	"tis620":   charmap.Windows874,
+	"euckr":    korean.EUCKR,
+	"koi8u":    charmap.KOI8U,
+	"gb2312":   simplifiedchinese.GBK,
+	"greek":    charmap.ISO8859_7,
+	"cp1250":   charmap.Windows1250,
+	"gbk":      simplifiedchinese.GBK,
+	"gb18030":  simplifiedchinese.GB18030,
+	"latin5":   charmap.ISO8859_9,
+	"ucs2":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"cp866":    charmap.CodePage866,
+	"macroman": charmap.Macintosh,
+	"cp852":    charmap.CodePage852,
+	"latin7":   charmap.ISO8859_13,
+	"cp1251":   charmap.Windows1251,
+	"utf16":    unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"utf16le":  unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"cp1256":   charmap.Windows1256,
+	"cp1257":   charmap.Windows1257,
+	"utf32":    utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM),
+	"cp932":    japanese.ShiftJIS,
+	"eucjpms":  japanese.EUCJP,
+}
+
+// 排序规则对应的字符集, 如gbk_chinese_ci为gbk
+func CollationCharset(collation string) string {
+	collation = strings.ToLower(collation)
+	if collation == "binary" {
+		return collation
+	}
+	if index := strings.IndexByte(collation, '_'); index > 0 {
+		return collation[:index]
+	}
+	return ""
+}
+
+// 排序规则ID对应的字符集, 未知时为空
+func CollationIdCharset(id int) string {
+	if id <= 0 || id > 0xff {
+		return ""
+	}
+	return CollationCharset(Collations[CollationId(id)])
+}
+
+// 字符集是否需要转换为UTF-8
+func NeedDecodeCharset(charset string) bool {
+	_, ok := charsetEncodings[strings.ToLower(charset)]
+	return ok
+}
+
+// 按字符集转换为UTF-8, 转换后不能再转换回原来的字节(数据不是该字符集的合法编码)时返回false
+func DecodeCharset(charset string, data []byte) (string, bool) {
+	enc, ok := charsetEncodings[strings.ToLower(charset)]
+	if !ok {
+		return string(data), true
+	}
+
+	text, err := enc.NewDecoder().Bytes(data)
+	if nil != err {
+		return "", false
+	}
+	origin, err := enc.NewEncoder().Bytes(text)
+	if nil != err || !bytes.Equal(origin, data) {
+		return "", false
+	}
+	return string(text), true
+}
@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestDecodeCharset(t *testing.T) {
+	if charset := CollationIdCharset(28); charset != "gbk" {
+		t.Fatalf("got charset %s", charset)
+	}
+	if charset := CollationCharset("utf8mb4_general_ci"); NeedDecodeCharset(charset) {
+		t.Fatalf("%s should not be decoded", charset)
+	}
+
+	cases := []struct {
+		charset string
+		data    []byte
+		expect  string
+		ok      bool
+	}{
+		{"gbk", []byte{0xd6, 0xd0, 0xce, 0xc4, 'a'}, "中文a", true},
+		{"latin1", []byte{'c', 'a', 'f', 0xe9}, "café", true},
+		{"utf8mb4", []byte("中文"), "中文", true},
+		{"gbk", []byte{0xd6}, "", false},
+		{"gbk", []byte{0xff, 0x41}, "", false},
+	}
+	for _, c := range cases {
+		text, ok := DecodeCharset(c.charset, c.data)
+		if ok != c.ok || text != c.expect {
+			t.Fatalf("%s %x: got %q %v", c.charset, c.data, text, ok)
+		}
+	}
+}
@@ -110,6 +110,7 @@ const (
 	MYSQL_TYPE_TIMESTAMP2  uint8 = 17  // timestamp
 	MYSQL_TYPE_DATETIME2   uint8 = 18  // time
 	MYSQL_TYPE_TIME2       uint8 = 19  // time
+	MYSQL_TYPE_JSON        uint8 = 245 // json
 	MYSQL_TYPE_NEWDECIMAL  uint8 = 246 // 浮点型
 	MYSQL_TYPE_ENUM        uint8 = 247
 	MYSQL_TYPE_SET         uint8 = 248
@@ -141,5 +142,21 @@ const (
 )
 
 const (
-	AUTH_NAME = "mysql_native_password"
+	AUTH_NAME                  = "mysql_native_password"
+	AUTH_CACHING_SHA2_PASSWORD = "caching_sha2_password"
+	AUTH_SHA256_PASSWORD       = "sha256_password"
+	AUTH_CLEAR_PASSWORD        = "mysql_clear_password"
+)
+
+// 认证过程中服务端返回的包头
+const (
+	AUTH_SWITCH_HEADER    byte = 0xfe
+	AUTH_MORE_DATA_HEADER byte = 0x01
+)
+
+// caching_sha2_password 认证过程中的指令
+const (
+	CACHING_SHA2_REQUEST_PUBLIC_KEY byte = 0x02
+	CACHING_SHA2_FAST_AUTH_SUCCESS  byte = 0x03
+	CACHING_SHA2_PERFORM_FULL_AUTH  byte = 0x04
 )
@@ -0,0 +1,206 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WKB中的几何类型
+const (
+	WKB_POINT              = 1
+	WKB_LINESTRING         = 2
+	WKB_POLYGON            = 3
+	WKB_MULTIPOINT         = 4
+	WKB_MULTILINESTRING    = 5
+	WKB_MULTIPOLYGON       = 6
+	WKB_GEOMETRYCOLLECTION = 7
+)
+
+var errGeometry = errors.New("GEOMETRY数据格式错误")
+
+// GEOMETRY列的值为 SRID(4字节) + WKB, 返回SRID与WKT文本
+func DecodeGeometry(data []byte) (uint32, string, error) {
+	if len(data) < 4 {
+		return 0, "", errGeometry
+	}
+
+	reader := &wkbReader{data: data[4:]}
+	var text strings.Builder
+	if err := reader.readGeometry(&text, 0); nil != err {
+		return 0, "", err
+	}
+	if reader.pos != len(reader.data) {
+		return 0, "", errGeometry
+	}
+	return binary.LittleEndian.Uint32(data), text.String(), nil
+}
+
+type wkbReader struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (this *wkbReader) readUInt32() (int, error) {
+	if this.pos+4 > len(this.data) {
+		return 0, errGeometry
+	}
+	value := this.order.Uint32(this.data[this.pos:])
+	this.pos += 4
+	return int(value), nil
+}
+
+// 读取字节序与类型, 集合中的每个元素都有自己的字节序
+func (this *wkbReader) readHeader() (int, error) {
+	if this.pos >= len(this.data) {
+		return 0, errGeometry
+	}
+	switch this.data[this.pos] {
+	case 0:
+		this.order = binary.BigEndian
+	case 1:
+		this.order = binary.LittleEndian
+	default:
+		return 0, errGeometry
+	}
+	this.pos++
+	return this.readUInt32()
+}
+
+// 读取一个几何对象, depth>0时在集合中, MULTI*的元素不带类型名
+func (this *wkbReader) readGeometry(text *strings.Builder, depth int) error {
+	wkbType, err := this.readHeader()
+	if nil != err {
+		return err
+	}
+
+	switch wkbType {
+	case WKB_POINT:
+		text.WriteString("POINT(")
+		err = this.readPoint(text)
+		text.WriteByte(')')
+	case WKB_LINESTRING:
+		text.WriteString("LINESTRING")
+		err = this.readPoints(text)
+	case WKB_POLYGON:
+		text.WriteString("POLYGON")
+		err = this.readPolygon(text)
+	case WKB_MULTIPOINT, WKB_MULTILINESTRING, WKB_MULTIPOLYGON:
+		names := map[int]string{WKB_MULTIPOINT: "MULTIPOINT", WKB_MULTILINESTRING: "MULTILINESTRING", WKB_MULTIPOLYGON: "MULTIPOLYGON"}
+		text.WriteString(names[wkbType])
+		err = this.readMulti(text, wkbType-3)
+	case WKB_GEOMETRYCOLLECTION:
+		if depth > 32 {
+			return errGeometry
+		}
+		text.WriteString("GEOMETRYCOLLECTION(")
+		var count int
+		if count, err = this.readUInt32(); nil != err {
+			return err
+		}
+		for i := 0; i < count && nil == err; i++ {
+			if i > 0 {
+				text.WriteByte(',')
+			}
+			err = this.readGeometry(text, depth+1)
+		}
+		text.WriteByte(')')
+	default:
+		return fmt.Errorf("不支持的GEOMETRY类型:%d", wkbType)
+	}
+	return err
+}
+
+// MULTI*中的元素为完整的WKB, 类型必须为elementType
+func (this *wkbReader) readMulti(text *strings.Builder, elementType int) error {
+	count, err := this.readUInt32()
+	if nil != err {
+		return err
+	}
+
+	text.WriteByte('(')
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			text.WriteByte(',')
+		}
+		wkbType, err := this.readHeader()
+		if nil != err {
+			return err
+		}
+		if wkbType != elementType {
+			return errGeometry
+		}
+
+		switch elementType {
+		case WKB_POINT:
+			err = this.readPoint(text)
+		case WKB_LINESTRING:
+			err = this.readPoints(text)
+		default:
+			err = this.readPolygon(text)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	text.WriteByte(')')
+	return nil
+}
+
+func (this *wkbReader) readPolygon(text *strings.Builder) error {
+	count, err := this.readUInt32()
+	if nil != err {
+		return err
+	}
+
+	text.WriteByte('(')
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			text.WriteByte(',')
+		}
+		if err := this.readPoints(text); nil != err {
+			return err
+		}
+	}
+	text.WriteByte(')')
+	return nil
+}
+
+func (this *wkbReader) readPoints(text *strings.Builder) error {
+	count, err := this.readUInt32()
+	if nil != err {
+		return err
+	}
+	if count > (len(this.data)-this.pos)/16 {
+		return errGeometry
+	}
+
+	text.WriteByte('(')
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			text.WriteByte(',')
+		}
+		this.readPoint(text)
+	}
+	text.WriteByte(')')
+	return nil
+}
+
+// 坐标按最短的精确表示输出, 不使用科学计数法
+func (this *wkbReader) readPoint(text *strings.Builder) error {
+	if this.pos+16 > len(this.data) {
+		return errGeometry
+	}
+	x := math.Float64frombits(this.order.Uint64(this.data[this.pos:]))
+	y := math.Float64frombits(this.order.Uint64(this.data[this.pos+8:]))
+	this.pos += 16
+
+	text.WriteString(strconv.FormatFloat(x, 'f', -1, 64))
+	text.WriteByte(' ')
+	text.WriteString(strconv.FormatFloat(y, 'f', -1, 64))
+	return nil
+}
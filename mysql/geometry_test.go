@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+type wkbWriter []byte
+
+func (this *wkbWriter) header(wkbType uint32) *wkbWriter {
+	*this = append(*this, 1)
+	return this.uint32(wkbType)
+}
+
+func (this *wkbWriter) uint32(value uint32) *wkbWriter {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, value)
+	*this = append(*this, buf...)
+	return this
+}
+
+func (this *wkbWriter) point(x, y float64) *wkbWriter {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf, math.Float64bits(x))
+	binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(y))
+	*this = append(*this, buf...)
+	return this
+}
+
+func TestDecodeGeometry(t *testing.T) {
+	point := new(wkbWriter).uint32(4326).header(WKB_POINT).point(116.397, 39.9)
+
+	polygon := new(wkbWriter).uint32(0).header(WKB_POLYGON).uint32(1).uint32(4)
+	polygon.point(0, 0).point(10, 0).point(10, 10).point(0, 0)
+
+	multiPoint := new(wkbWriter).uint32(0).header(WKB_MULTIPOINT).uint32(2)
+	multiPoint.header(WKB_POINT).point(1, 1).header(WKB_POINT).point(-2.5, 1e21)
+
+	collection := new(wkbWriter).uint32(0).header(WKB_GEOMETRYCOLLECTION).uint32(2)
+	collection.header(WKB_POINT).point(1, 2).header(WKB_LINESTRING).uint32(2).point(0, 0).point(1, 1)
+
+	cases := []struct {
+		data   []byte
+		srid   uint32
+		expect string
+	}{
+		{*point, 4326, "POINT(116.397 39.9)"},
+		{*polygon, 0, "POLYGON((0 0,10 0,10 10,0 0))"},
+		{*multiPoint, 0, "MULTIPOINT(1 1,-2.5 1000000000000000000000)"},
+		{*collection, 0, "GEOMETRYCOLLECTION(POINT(1 2),LINESTRING(0 0,1 1))"},
+	}
+	for _, c := range cases {
+		srid, text, err := DecodeGeometry(c.data)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if srid != c.srid || text != c.expect {
+			t.Fatalf("got %d %s, expect %d %s", srid, text, c.srid, c.expect)
+		}
+	}
+
+	if _, _, err := DecodeGeometry((*point)[:20]); nil == err {
+		t.Fatal("truncated geometry should fail")
+	}
+}
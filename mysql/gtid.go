@@ -0,0 +1,255 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GtidInterval 一段连续的GNO 左闭右开 [Start, Stop)
+type GtidInterval struct {
+	Start int64
+	Stop  int64
+}
+
+// UUIDSet 同一个server_uuid下的GNO集合
+type UUIDSet struct {
+	SID       []byte // 16字节的server_uuid
+	Intervals []GtidInterval
+}
+
+// GtidSet MySQL的GTID集合, 格式如 uuid:1-5:7,uuid2:1-3
+type GtidSet struct {
+	Sets map[string]*UUIDSet
+}
+
+func NewGtidSet() *GtidSet {
+	this := new(GtidSet)
+	this.Sets = make(map[string]*UUIDSet)
+	return this
+}
+
+func ParseGtidSet(str string) (*GtidSet, error) {
+	this := NewGtidSet()
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return this, nil
+	}
+
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid gtid set %s", item)
+		}
+
+		sid, err := ParseSID(parts[0])
+		if nil != err {
+			return nil, err
+		}
+
+		for _, part := range parts[1:] {
+			var start, stop int64
+			sep := strings.Index(part, "-")
+			if sep == -1 {
+				if start, err = strconv.ParseInt(part, 10, 64); nil != err {
+					return nil, fmt.Errorf("invalid gtid interval %s", part)
+				}
+				stop = start
+			} else {
+				if start, err = strconv.ParseInt(part[:sep], 10, 64); nil != err {
+					return nil, fmt.Errorf("invalid gtid interval %s", part)
+				}
+				if stop, err = strconv.ParseInt(part[sep+1:], 10, 64); nil != err {
+					return nil, fmt.Errorf("invalid gtid interval %s", part)
+				}
+			}
+
+			if start < 1 || stop < start {
+				return nil, fmt.Errorf("invalid gtid interval %s", part)
+			}
+			this.AddInterval(sid, GtidInterval{Start: start, Stop: stop + 1})
+		}
+	}
+
+	return this, nil
+}
+
+// ParseSID 解析server_uuid 返回16字节
+func ParseSID(str string) ([]byte, error) {
+	str = strings.Replace(strings.TrimSpace(str), "-", "", -1)
+	if len(str) != 32 {
+		return nil, errors.New("invalid server uuid " + str)
+	}
+
+	sid, err := hex.DecodeString(str)
+	if nil != err {
+		return nil, errors.New("invalid server uuid " + str)
+	}
+	return sid, nil
+}
+
+// FormatSID 把16字节的server_uuid转换为标准格式
+func FormatSID(sid []byte) string {
+	s := hex.EncodeToString(sid)
+	if len(s) != 32 {
+		return s
+	}
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+func (this *GtidSet) AddInterval(sid []byte, interval GtidInterval) {
+	key := FormatSID(sid)
+	uuidSet, ok := this.Sets[key]
+	if !ok {
+		uuidSet = &UUIDSet{SID: sid}
+		this.Sets[key] = uuidSet
+	}
+	uuidSet.Intervals = append(uuidSet.Intervals, interval)
+	uuidSet.normalize()
+}
+
+// AddGtid 加入单个gtid
+func (this *GtidSet) AddGtid(sid []byte, gno int64) {
+	this.AddInterval(sid, GtidInterval{Start: gno, Stop: gno + 1})
+}
+
+// Contain 判断gtid是否在集合中
+func (this *GtidSet) Contain(sid []byte, gno int64) bool {
+	uuidSet, ok := this.Sets[FormatSID(sid)]
+	if !ok {
+		return false
+	}
+
+	for _, interval := range uuidSet.Intervals {
+		if gno >= interval.Start && gno < interval.Stop {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *GtidSet) IsEmpty() bool {
+	return len(this.Sets) == 0
+}
+
+func (this *GtidSet) Clone() *GtidSet {
+	clone := NewGtidSet()
+	for key, uuidSet := range this.Sets {
+		intervals := make([]GtidInterval, len(uuidSet.Intervals))
+		copy(intervals, uuidSet.Intervals)
+		clone.Sets[key] = &UUIDSet{SID: uuidSet.SID, Intervals: intervals}
+	}
+	return clone
+}
+
+func (this *GtidSet) sortedKeys() []string {
+	keys := make([]string, 0, len(this.Sets))
+	for key := range this.Sets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (this *GtidSet) String() string {
+	items := make([]string, 0, len(this.Sets))
+	for _, key := range this.sortedKeys() {
+		items = append(items, this.Sets[key].String())
+	}
+	return strings.Join(items, ",")
+}
+
+// Encode COM_BINLOG_DUMP_GTID中使用的二进制格式
+func (this *GtidSet) Encode() []byte {
+	data := make([]byte, 0, 8+len(this.Sets)*40)
+	data = append(data, Uint64ToBytes(uint64(len(this.Sets)))...)
+	for _, key := range this.sortedKeys() {
+		uuidSet := this.Sets[key]
+		data = append(data, uuidSet.SID...)
+		data = append(data, Uint64ToBytes(uint64(len(uuidSet.Intervals)))...)
+		for _, interval := range uuidSet.Intervals {
+			data = append(data, Uint64ToBytes(uint64(interval.Start))...)
+			data = append(data, Uint64ToBytes(uint64(interval.Stop))...)
+		}
+	}
+	return data
+}
+
+// DecodeGtidSet 解析Encode格式的GTID集合(PREVIOUS_GTIDS_LOG_EVENT中同样使用)
+func DecodeGtidSet(data []byte) (*GtidSet, error) {
+	this := NewGtidSet()
+	if len(data) < 8 {
+		return nil, ErrMalformPacket
+	}
+
+	//数量来自数据本身, 数据损坏时可能非常大, 先按剩余长度检查以免溢出
+	nSids := int(binary.LittleEndian.Uint64(data))
+	if nSids < 0 || nSids > (len(data)-8)/24 {
+		return nil, ErrMalformPacket
+	}
+	pos := 8
+	for i := 0; i < nSids; i++ {
+		if len(data) < pos+16+8 {
+			return nil, ErrMalformPacket
+		}
+		sid := make([]byte, 16)
+		copy(sid, data[pos:pos+16])
+		pos += 16
+
+		nIntervals := int(binary.LittleEndian.Uint64(data[pos:]))
+		pos += 8
+		if nIntervals < 0 || nIntervals > (len(data)-pos)/16 {
+			return nil, ErrMalformPacket
+		}
+
+		for j := 0; j < nIntervals; j++ {
+			start := int64(binary.LittleEndian.Uint64(data[pos:]))
+			stop := int64(binary.LittleEndian.Uint64(data[pos+8:]))
+			pos += 16
+			this.AddInterval(sid, GtidInterval{Start: start, Stop: stop})
+		}
+	}
+
+	return this, nil
+}
+
+func (this *UUIDSet) String() string {
+	str := FormatSID(this.SID)
+	for _, interval := range this.Intervals {
+		if interval.Stop-interval.Start == 1 {
+			str += fmt.Sprintf(":%d", interval.Start)
+		} else {
+			str += fmt.Sprintf(":%d-%d", interval.Start, interval.Stop-1)
+		}
+	}
+	return str
+}
+
+// 排序并合并相邻或重叠的区间
+func (this *UUIDSet) normalize() {
+	sort.Slice(this.Intervals, func(i, j int) bool {
+		return this.Intervals[i].Start < this.Intervals[j].Start
+	})
+
+	merged := this.Intervals[:0]
+	for _, interval := range this.Intervals {
+		last := len(merged) - 1
+		if last >= 0 && interval.Start <= merged[last].Stop {
+			if interval.Stop > merged[last].Stop {
+				merged[last].Stop = interval.Stop
+			}
+		} else {
+			merged = append(merged, interval)
+		}
+	}
+	this.Intervals = merged
+}
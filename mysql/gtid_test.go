@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseGtidSet(t *testing.T) {
+	set, err := ParseGtidSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:7-9:1-5:6, 4e11fa47-71ca-11e1-9e33-c80aa9429562:3")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	expect := "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-9,4e11fa47-71ca-11e1-9e33-c80aa9429562:3"
+	if set.String() != expect {
+		t.Fatalf("got %s, expect %s", set.String(), expect)
+	}
+
+	sid, _ := ParseSID("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+	if !set.Contain(sid, 9) || set.Contain(sid, 10) {
+		t.Fatal("contain check failed")
+	}
+
+	for _, bad := range []string{"abc:1", "3e11fa47-71ca-11e1-9e33-c80aa9429562", "3e11fa47-71ca-11e1-9e33-c80aa9429562:5-3"} {
+		if _, err := ParseGtidSet(bad); nil == err {
+			t.Fatalf("%s should be invalid", bad)
+		}
+	}
+}
+
+func TestGtidSetEncode(t *testing.T) {
+	set, _ := ParseGtidSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5")
+	data := set.Encode()
+
+	sid, _ := ParseSID("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+	expect := append([]byte{}, Uint64ToBytes(1)...)
+	expect = append(expect, sid...)
+	expect = append(expect, Uint64ToBytes(1)...)
+	expect = append(expect, Uint64ToBytes(1)...)
+	expect = append(expect, Uint64ToBytes(6)...)
+
+	if !bytes.Equal(data, expect) {
+		t.Fatalf("got % x, expect % x", data, expect)
+	}
+
+	decoded, err := DecodeGtidSet(data)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if decoded.String() != set.String() {
+		t.Fatalf("got %s, expect %s", decoded.String(), set.String())
+	}
+	//损坏的数量不能越界读取
+	for _, offset := range []int{0, 24} {
+		corrupt := append([]byte{}, data...)
+		copy(corrupt[offset:], Uint64ToBytes(1<<60))
+		if _, err := DecodeGtidSet(corrupt); nil == err {
+			t.Fatalf("count at %d should be rejected", offset)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package mysql
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSON列在binlog中的二进制格式(MySQL 5.7 json_binary)
+const (
+	JSONB_TYPE_SMALL_OBJECT = 0x00
+	JSONB_TYPE_LARGE_OBJECT = 0x01
+	JSONB_TYPE_SMALL_ARRAY  = 0x02
+	JSONB_TYPE_LARGE_ARRAY  = 0x03
+	JSONB_TYPE_LITERAL      = 0x04
+	JSONB_TYPE_INT16        = 0x05
+	JSONB_TYPE_UINT16       = 0x06
+	JSONB_TYPE_INT32        = 0x07
+	JSONB_TYPE_UINT32       = 0x08
+	JSONB_TYPE_INT64        = 0x09
+	JSONB_TYPE_UINT64       = 0x0a
+	JSONB_TYPE_DOUBLE       = 0x0b
+	JSONB_TYPE_STRING       = 0x0c
+	JSONB_TYPE_OPAQUE       = 0x0f
+
+	JSONB_LITERAL_NULL  = 0x00
+	JSONB_LITERAL_TRUE  = 0x01
+	JSONB_LITERAL_FALSE = 0x02
+)
+
+var errJsonBinary = errors.New("JSON二进制数据格式错误")
+
+// JSON值的种类
+const (
+	JSON_NODE_SCALAR = iota
+	JSON_NODE_OBJECT
+	JSON_NODE_ARRAY
+)
+
+// 解析后的JSON值, 标量保存输出文本, 对象的键按MySQL的顺序排列
+type JsonNode struct {
+	Kind   int
+	Text   string
+	Keys   []string
+	Values []*JsonNode
+}
+
+// 把JSON列的二进制数据转换为JSON文本, 格式与MySQL输出的一致
+func DecodeJsonBinary(data []byte) (string, error) {
+	node, err := ParseJsonBinary(data)
+	if nil != err {
+		return "", err
+	}
+	return node.String(), nil
+}
+
+// 解析JSON列的二进制数据
+func ParseJsonBinary(data []byte) (*JsonNode, error) {
+	//空数据表示JSON null
+	if len(data) == 0 {
+		return &JsonNode{Kind: JSON_NODE_SCALAR, Text: "null"}, nil
+	}
+	return parseJsonValue(data[0], data[1:])
+}
+
+func (this *JsonNode) String() string {
+	var text strings.Builder
+	this.writeTo(&text)
+	return text.String()
+}
+
+func (this *JsonNode) writeTo(text *strings.Builder) {
+	switch this.Kind {
+	case JSON_NODE_OBJECT:
+		text.WriteByte('{')
+		for i, key := range this.Keys {
+			if i > 0 {
+				text.WriteString(", ")
+			}
+			writeJsonString(text, key)
+			text.WriteString(": ")
+			this.Values[i].writeTo(text)
+		}
+		text.WriteByte('}')
+	case JSON_NODE_ARRAY:
+		text.WriteByte('[')
+		for i, value := range this.Values {
+			if i > 0 {
+				text.WriteString(", ")
+			}
+			value.writeTo(text)
+		}
+		text.WriteByte(']')
+	default:
+		text.WriteString(this.Text)
+	}
+}
+
+// 深拷贝, 修改副本时不影响原值
+func (this *JsonNode) Clone() *JsonNode {
+	node := &JsonNode{Kind: this.Kind, Text: this.Text}
+	if nil != this.Keys {
+		node.Keys = append([]string{}, this.Keys...)
+	}
+	if nil != this.Values {
+		node.Values = make([]*JsonNode, len(this.Values))
+		for i, value := range this.Values {
+			node.Values[i] = value.Clone()
+		}
+	}
+	return node
+}
+
+func parseJsonValue(valueType byte, data []byte) (*JsonNode, error) {
+	switch valueType {
+	case JSONB_TYPE_SMALL_OBJECT:
+		return parseJsonContainer(data, true, false)
+	case JSONB_TYPE_LARGE_OBJECT:
+		return parseJsonContainer(data, true, true)
+	case JSONB_TYPE_SMALL_ARRAY:
+		return parseJsonContainer(data, false, false)
+	case JSONB_TYPE_LARGE_ARRAY:
+		return parseJsonContainer(data, false, true)
+	}
+
+	var text strings.Builder
+	switch valueType {
+	case JSONB_TYPE_LITERAL:
+		if len(data) < 1 {
+			return nil, errJsonBinary
+		}
+		switch data[0] {
+		case JSONB_LITERAL_NULL:
+			text.WriteString("null")
+		case JSONB_LITERAL_TRUE:
+			text.WriteString("true")
+		case JSONB_LITERAL_FALSE:
+			text.WriteString("false")
+		default:
+			return nil, errJsonBinary
+		}
+	case JSONB_TYPE_INT16, JSONB_TYPE_UINT16:
+		if len(data) < 2 {
+			return nil, errJsonBinary
+		}
+		if valueType == JSONB_TYPE_INT16 {
+			text.WriteString(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(data))), 10))
+		} else {
+			text.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint16(data)), 10))
+		}
+	case JSONB_TYPE_INT32, JSONB_TYPE_UINT32:
+		if len(data) < 4 {
+			return nil, errJsonBinary
+		}
+		if valueType == JSONB_TYPE_INT32 {
+			text.WriteString(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(data))), 10))
+		} else {
+			text.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data)), 10))
+		}
+	case JSONB_TYPE_INT64, JSONB_TYPE_UINT64, JSONB_TYPE_DOUBLE:
+		if len(data) < 8 {
+			return nil, errJsonBinary
+		}
+		value := binary.LittleEndian.Uint64(data)
+		switch valueType {
+		case JSONB_TYPE_INT64:
+			text.WriteString(strconv.FormatInt(int64(value), 10))
+		case JSONB_TYPE_UINT64:
+			text.WriteString(strconv.FormatUint(value, 10))
+		default:
+			text.WriteString(formatJsonDouble(math.Float64frombits(value)))
+		}
+	case JSONB_TYPE_STRING:
+		length, n, err := decodeJsonVarLen(data)
+		if nil != err || n+length > len(data) {
+			return nil, errJsonBinary
+		}
+		writeJsonString(&text, string(data[n:n+length]))
+	case JSONB_TYPE_OPAQUE:
+		if err := decodeJsonOpaque(&text, data); nil != err {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("未知的JSON值类型:%d", valueType)
+	}
+	return &JsonNode{Kind: JSON_NODE_SCALAR, Text: text.String()}, nil
+}
+
+// 对象: 元素个数 + 总长度 + 键的位置与长度 + 值的类型与位置(或内联的值) + 键 + 值
+// 数组: 元素个数 + 总长度 + 值的类型与位置(或内联的值) + 值
+// small格式的个数、长度、位置为2字节, large格式为4字节, 位置从元素个数开始计算
+func parseJsonContainer(data []byte, isObject bool, large bool) (*JsonNode, error) {
+	offsetSize := 2
+	if large {
+		offsetSize = 4
+	}
+	readOffset := func(pos int) (int, error) {
+		if pos+offsetSize > len(data) {
+			return 0, errJsonBinary
+		}
+		if large {
+			return int(binary.LittleEndian.Uint32(data[pos:])), nil
+		}
+		return int(binary.LittleEndian.Uint16(data[pos:])), nil
+	}
+
+	count, err := readOffset(0)
+	if nil != err {
+		return nil, err
+	}
+	size, err := readOffset(offsetSize)
+	if nil != err || size > len(data) {
+		return nil, errJsonBinary
+	}
+	data = data[:size]
+
+	keyEntrySize := offsetSize + 2
+	valueEntrySize := 1 + offsetSize
+	valueEntryStart := 2 * offsetSize
+	if isObject {
+		valueEntryStart += count * keyEntrySize
+	}
+	if valueEntryStart+count*valueEntrySize > len(data) {
+		return nil, errJsonBinary
+	}
+
+	node := &JsonNode{Kind: JSON_NODE_ARRAY, Values: make([]*JsonNode, 0, count)}
+	if isObject {
+		node.Kind = JSON_NODE_OBJECT
+		node.Keys = make([]string, 0, count)
+	}
+
+	for i := 0; i < count; i++ {
+		if isObject {
+			keyEntry := 2*offsetSize + i*keyEntrySize
+			keyOffset, _ := readOffset(keyEntry)
+			keyLength := int(binary.LittleEndian.Uint16(data[keyEntry+offsetSize:]))
+			if keyOffset+keyLength > len(data) {
+				return nil, errJsonBinary
+			}
+			node.Keys = append(node.Keys, string(data[keyOffset:keyOffset+keyLength]))
+		}
+
+		var value *JsonNode
+		valueEntry := valueEntryStart + i*valueEntrySize
+		valueType := data[valueEntry]
+		if isJsonInlined(valueType, large) {
+			value, err = parseJsonValue(valueType, data[valueEntry+1:valueEntry+valueEntrySize])
+		} else {
+			valueOffset, _ := readOffset(valueEntry + 1)
+			if valueOffset >= len(data) {
+				return nil, errJsonBinary
+			}
+			value, err = parseJsonValue(valueType, data[valueOffset:])
+		}
+		if nil != err {
+			return nil, err
+		}
+		node.Values = append(node.Values, value)
+	}
+	return node, nil
+}
+
+// 字面量以及16位整数直接保存在值的位置上, large格式下32位整数也是
+func isJsonInlined(valueType byte, large bool) bool {
+	switch valueType {
+	case JSONB_TYPE_LITERAL, JSONB_TYPE_INT16, JSONB_TYPE_UINT16:
+		return true
+	case JSONB_TYPE_INT32, JSONB_TYPE_UINT32:
+		return large
+	}
+	return false
+}
+
+// 字符串长度: 每字节7位, 最高位为1表示还有后续字节
+func decodeJsonVarLen(data []byte) (int, int, error) {
+	length := 0
+	for i := 0; i < len(data) && i < 5; i++ {
+		length |= int(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			return length, i + 1, nil
+		}
+	}
+	return 0, 0, errJsonBinary
+}
+
+// 不透明类型: MySQL字段类型(1字节) + 长度 + 数据, 时间、DECIMAL按MySQL的格式输出, 其他输出base64
+func decodeJsonOpaque(text *strings.Builder, data []byte) error {
+	if len(data) < 1 {
+		return errJsonBinary
+	}
+	fieldType := data[0]
+	length, n, err := decodeJsonVarLen(data[1:])
+	if nil != err || 1+n+length > len(data) {
+		return errJsonBinary
+	}
+	value := data[1+n : 1+n+length]
+
+	switch fieldType {
+	case MYSQL_TYPE_NEWDECIMAL:
+		if len(value) < 2 {
+			return errJsonBinary
+		}
+		decimal, _ := NewLogBuffer(value[2:]).GetDecimal(int(value[0]), int(value[1]))
+		text.WriteString(decimal)
+	case MYSQL_TYPE_DATE, MYSQL_TYPE_DATETIME, MYSQL_TYPE_TIMESTAMP, MYSQL_TYPE_TIME:
+		if len(value) < 8 {
+			return errJsonBinary
+		}
+		text.WriteString(`"` + formatJsonTime(fieldType, int64(binary.LittleEndian.Uint64(value))) + `"`)
+	default:
+		text.WriteString(fmt.Sprintf(`"base64:type%d:%s"`, fieldType, base64.StdEncoding.EncodeToString(value)))
+	}
+	return nil
+}
+
+// 时间类型在JSON中以MySQL内部的压缩整数保存
+func formatJsonTime(fieldType byte, packed int64) string {
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+	frac := packed % (1 << 24)
+	intPart := packed >> 24
+
+	if fieldType == MYSQL_TYPE_TIME {
+		hms := intPart
+		return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, (hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6), frac)
+	}
+
+	ymd := intPart >> 17
+	ym := ymd >> 5
+	hms := intPart % (1 << 17)
+	date := fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd%(1<<5))
+	if fieldType == MYSQL_TYPE_DATE {
+		return date
+	}
+	return fmt.Sprintf("%s %02d:%02d:%02d.%06d", date, hms>>12, (hms>>6)%(1<<6), hms%(1<<6), frac)
+}
+
+// 整数值的浮点数带上小数点, 与整数区分
+func formatJsonDouble(value float64) string {
+	text := strings.Replace(strconv.FormatFloat(value, 'g', -1, 64), "e+", "e", 1)
+	if !strings.ContainsAny(text, ".eEnN") {
+		text += ".0"
+	}
+	return text
+}
+
+// JSON字符串转义
+func writeJsonString(text *strings.Builder, value string) {
+	text.WriteByte('"')
+	for i := 0; i < len(value); {
+		r, width := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case r == '"':
+			text.WriteString(`\"`)
+		case r == '\\':
+			text.WriteString(`\\`)
+		case r == '\n':
+			text.WriteString(`\n`)
+		case r == '\r':
+			text.WriteString(`\r`)
+		case r == '\t':
+			text.WriteString(`\t`)
+		case r == '\b':
+			text.WriteString(`\b`)
+		case r == '\f':
+			text.WriteString(`\f`)
+		case r < 0x20:
+			text.WriteString(fmt.Sprintf(`\u%04x`, r))
+		default:
+			text.WriteString(value[i : i+width])
+		}
+		i += width
+	}
+	text.WriteByte('"')
+}
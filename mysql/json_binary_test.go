@@ -0,0 +1,53 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestDecodeJsonBinary(t *testing.T) {
+	//{"a": [1, true], "b": "x\"y"}
+	object := []byte{JSONB_TYPE_SMALL_OBJECT,
+		2, 0, 34, 0, //元素个数、总长度
+		18, 0, 1, 0, 19, 0, 1, 0, //键的位置与长度
+		JSONB_TYPE_SMALL_ARRAY, 20, 0, JSONB_TYPE_STRING, 30, 0, //值的类型与位置
+		'a', 'b',
+		2, 0, 10, 0, JSONB_TYPE_INT16, 1, 0, JSONB_TYPE_LITERAL, JSONB_LITERAL_TRUE, 0,
+		3, 'x', '"', 'y',
+	}
+
+	double := make([]byte, 9)
+	double[0] = JSONB_TYPE_DOUBLE
+	binary.LittleEndian.PutUint64(double[1:], math.Float64bits(2))
+
+	int64Value := make([]byte, 9)
+	int64Value[0] = JSONB_TYPE_INT64
+	binary.LittleEndian.PutUint64(int64Value[1:], uint64(0xffffffffffffffff))
+
+	cases := []struct {
+		data   []byte
+		expect string
+	}{
+		{object, `{"a": [1, true], "b": "x\"y"}`},
+		{double, "2.0"},
+		{int64Value, "-1"},
+		{[]byte{JSONB_TYPE_LITERAL, JSONB_LITERAL_NULL}, "null"},
+		{[]byte{JSONB_TYPE_STRING, 2, '\n', 'a'}, `"\na"`},
+		{nil, "null"},
+	}
+	for _, c := range cases {
+		got, err := DecodeJsonBinary(c.data)
+		if nil != err {
+			t.Fatalf("decode %v: %s", c.data, err.Error())
+		}
+		if got != c.expect {
+			t.Fatalf("got %s, expect %s", got, c.expect)
+		}
+	}
+
+	//长度超出数据范围
+	if _, err := DecodeJsonBinary([]byte{JSONB_TYPE_SMALL_ARRAY, 1, 0, 100, 0}); nil == err {
+		t.Fatal("truncated data should fail")
+	}
+}
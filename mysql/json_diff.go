@@ -0,0 +1,283 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PARTIAL_UPDATE_ROWS_EVENT中JSON列的修改操作
+const (
+	JSON_DIFF_REPLACE = 0
+	JSON_DIFF_INSERT  = 1
+	JSON_DIFF_REMOVE  = 2
+)
+
+// JSON列的一次部分修改, REMOVE没有Value
+type JsonDiff struct {
+	Operation int
+	Path      string
+	Value     *JsonNode
+}
+
+// 路径中的一段: 对象的键或者数组下标
+type jsonPathLeg struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+var errJsonDiff = errors.New("JSON部分修改数据格式错误")
+
+// 解析JSON列的修改列表: 每项为 操作(1字节) + 路径长度 + 路径 + 值长度 + 二进制JSON值(REMOVE没有值)
+func ParseJsonDiffs(data []byte) ([]*JsonDiff, error) {
+	diffs := make([]*JsonDiff, 0, 1)
+	for pos := 0; pos < len(data); {
+		diff := &JsonDiff{Operation: int(data[pos])}
+		if diff.Operation > JSON_DIFF_REMOVE {
+			return nil, fmt.Errorf("未知的JSON修改操作:%d", diff.Operation)
+		}
+		pos++
+
+		length, n, err := decodeJsonDiffLen(data[pos:])
+		if nil != err || pos+n+length > len(data) {
+			return nil, errJsonDiff
+		}
+		diff.Path = string(data[pos+n : pos+n+length])
+		pos += n + length
+
+		if diff.Operation != JSON_DIFF_REMOVE {
+			length, n, err = decodeJsonDiffLen(data[pos:])
+			if nil != err || pos+n+length > len(data) {
+				return nil, errJsonDiff
+			}
+			if diff.Value, err = ParseJsonBinary(data[pos+n : pos+n+length]); nil != err {
+				return nil, err
+			}
+			pos += n + length
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// 长度为MySQL的packed integer
+func decodeJsonDiffLen(data []byte) (int, int, error) {
+	if len(data) < 1 {
+		return 0, 0, errJsonDiff
+	}
+	switch {
+	case data[0] < 0xfb:
+		return int(data[0]), 1, nil
+	case data[0] == 0xfc && len(data) >= 3:
+		return int(data[1]) | int(data[2])<<8, 3, nil
+	case data[0] == 0xfd && len(data) >= 4:
+		return int(data[1]) | int(data[2])<<8 | int(data[3])<<16, 4, nil
+	case data[0] == 0xfe && len(data) >= 9:
+		length := 0
+		for i := 8; i > 0; i-- {
+			length = length<<8 | int(data[i])
+		}
+		return length, 9, nil
+	}
+	return 0, 0, errJsonDiff
+}
+
+// 修改的位置是否为数组元素, 插入数组元素时需要用JSON_ARRAY_INSERT
+func (this *JsonDiff) InArray() bool {
+	legs, err := parseJsonPath(this.Path)
+	return nil == err && len(legs) > 0 && legs[len(legs)-1].isIndex
+}
+
+// 在JSON值上执行修改, 返回撤销这次修改的操作
+func (this *JsonNode) Apply(diff *JsonDiff) (*JsonDiff, error) {
+	legs, err := parseJsonPath(diff.Path)
+	if nil != err {
+		return nil, err
+	}
+
+	//修改整个文档
+	if len(legs) == 0 {
+		if diff.Operation != JSON_DIFF_REPLACE {
+			return nil, fmt.Errorf("不能对%s执行该操作", diff.Path)
+		}
+		undo := &JsonDiff{Operation: JSON_DIFF_REPLACE, Path: diff.Path, Value: this.Clone()}
+		*this = *diff.Value.Clone()
+		return undo, nil
+	}
+
+	parent := this
+	for _, leg := range legs[:len(legs)-1] {
+		if parent = parent.child(leg); nil == parent {
+			return nil, fmt.Errorf("JSON路径%s不存在", diff.Path)
+		}
+	}
+
+	last := legs[len(legs)-1]
+	if last.isIndex {
+		if parent.Kind != JSON_NODE_ARRAY {
+			return nil, fmt.Errorf("JSON路径%s不是数组", diff.Path)
+		}
+	} else if parent.Kind != JSON_NODE_OBJECT {
+		return nil, fmt.Errorf("JSON路径%s不是对象", diff.Path)
+	}
+	i, found := parent.find(last)
+
+	switch diff.Operation {
+	case JSON_DIFF_REPLACE:
+		if !found {
+			return nil, fmt.Errorf("JSON路径%s不存在", diff.Path)
+		}
+		undo := &JsonDiff{Operation: JSON_DIFF_REPLACE, Path: diff.Path, Value: parent.Values[i]}
+		parent.Values[i] = diff.Value.Clone()
+		return undo, nil
+	case JSON_DIFF_INSERT:
+		if found && !last.isIndex {
+			return nil, fmt.Errorf("JSON路径%s已存在", diff.Path)
+		}
+		//下标超出数组长度时追加到末尾, 撤销时使用实际的下标
+		legs[len(legs)-1].index = i
+		parent.Values = append(parent.Values, nil)
+		copy(parent.Values[i+1:], parent.Values[i:])
+		parent.Values[i] = diff.Value.Clone()
+		if !last.isIndex {
+			parent.Keys = append(parent.Keys, "")
+			copy(parent.Keys[i+1:], parent.Keys[i:])
+			parent.Keys[i] = last.key
+		}
+		return &JsonDiff{Operation: JSON_DIFF_REMOVE, Path: formatJsonPath(legs)}, nil
+	default:
+		if !found {
+			return nil, fmt.Errorf("JSON路径%s不存在", diff.Path)
+		}
+		undo := &JsonDiff{Operation: JSON_DIFF_INSERT, Path: diff.Path, Value: parent.Values[i]}
+		parent.Values = append(parent.Values[:i], parent.Values[i+1:]...)
+		if !last.isIndex {
+			parent.Keys = append(parent.Keys[:i], parent.Keys[i+1:]...)
+		}
+		return undo, nil
+	}
+}
+
+func (this *JsonNode) child(leg jsonPathLeg) *JsonNode {
+	if (leg.isIndex && this.Kind != JSON_NODE_ARRAY) || (!leg.isIndex && this.Kind != JSON_NODE_OBJECT) {
+		return nil
+	}
+	if i, found := this.find(leg); found {
+		return this.Values[i]
+	}
+	return nil
+}
+
+// 返回元素的位置; 不存在时返回插入的位置, 对象的键按长度、字节序排列
+func (this *JsonNode) find(leg jsonPathLeg) (int, bool) {
+	if leg.isIndex {
+		if leg.index < len(this.Values) {
+			return leg.index, true
+		}
+		return len(this.Values), false
+	}
+
+	for i, key := range this.Keys {
+		if key == leg.key {
+			return i, true
+		}
+		if len(key) > len(leg.key) || (len(key) == len(leg.key) && key > leg.key) {
+			return i, false
+		}
+	}
+	return len(this.Keys), false
+}
+
+// 解析 $.a."b c"[1] 形式的路径
+func parseJsonPath(path string) ([]jsonPathLeg, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("不支持的JSON路径:%s", path)
+	}
+
+	legs := make([]jsonPathLeg, 0, 2)
+	for pos := 1; pos < len(path); {
+		switch path[pos] {
+		case '.':
+			pos++
+			if pos < len(path) && path[pos] == '"' {
+				end := pos + 1
+				for end < len(path) && path[end] != '"' {
+					if path[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(path) {
+					return nil, fmt.Errorf("不支持的JSON路径:%s", path)
+				}
+				key, err := strconv.Unquote(path[pos : end+1])
+				if nil != err {
+					return nil, fmt.Errorf("不支持的JSON路径:%s", path)
+				}
+				legs = append(legs, jsonPathLeg{key: key})
+				pos = end + 1
+			} else {
+				end := pos
+				for end < len(path) && path[end] != '.' && path[end] != '[' {
+					end++
+				}
+				if end == pos {
+					return nil, fmt.Errorf("不支持的JSON路径:%s", path)
+				}
+				legs = append(legs, jsonPathLeg{key: path[pos:end]})
+				pos = end
+			}
+		case '[':
+			end := strings.IndexByte(path[pos:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("不支持的JSON路径:%s", path)
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(path[pos+1 : pos+end]))
+			if nil != err || index < 0 {
+				return nil, fmt.Errorf("不支持的JSON路径:%s", path)
+			}
+			legs = append(legs, jsonPathLeg{index: index, isIndex: true})
+			pos += end + 1
+		case ' ':
+			pos++
+		default:
+			return nil, fmt.Errorf("不支持的JSON路径:%s", path)
+		}
+	}
+	return legs, nil
+}
+
+func formatJsonPath(legs []jsonPathLeg) string {
+	var path strings.Builder
+	path.WriteByte('$')
+	for _, leg := range legs {
+		if leg.isIndex {
+			path.WriteString("[" + strconv.Itoa(leg.index) + "]")
+		} else if isJsonIdentifier(leg.key) {
+			path.WriteString("." + leg.key)
+		} else {
+			path.WriteByte('.')
+			writeJsonString(&path, leg.key)
+		}
+	}
+	return path.String()
+}
+
+func isJsonIdentifier(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		if r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r > 0x7f {
+			continue
+		}
+		if i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
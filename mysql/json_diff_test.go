@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"testing"
+)
+
+func TestJsonDiff(t *testing.T) {
+	data := []byte{JSON_DIFF_REPLACE, 3, '$', '.', 'b', 3, JSONB_TYPE_STRING, 1, 'y'}
+	data = append(data, JSON_DIFF_INSERT, 6, '$', '.', 'a', '[', '5', ']', 3, JSONB_TYPE_INT16, 3, 0)
+	data = append(data, JSON_DIFF_REMOVE, 6, '$', '.', 'a', '[', '0', ']')
+	data = append(data, JSON_DIFF_INSERT, 7, '$', '.', '"', 'c', ' ', 'd', '"', 2, JSONB_TYPE_LITERAL, JSONB_LITERAL_TRUE)
+	diffs, err := ParseJsonDiffs(data)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(diffs) != 4 {
+		t.Fatalf("got %d diffs", len(diffs))
+	}
+
+	//{"a": [1, 2], "b": "x"}
+	before := &JsonNode{Kind: JSON_NODE_OBJECT, Keys: []string{"a", "b"}, Values: []*JsonNode{
+		{Kind: JSON_NODE_ARRAY, Values: []*JsonNode{{Text: "1"}, {Text: "2"}}},
+		{Text: `"x"`},
+	}}
+	doc := before.Clone()
+	undos := make([]*JsonDiff, 0, len(diffs))
+	for _, diff := range diffs {
+		undo, err := doc.Apply(diff)
+		if nil != err {
+			t.Fatal(err)
+		}
+		undos = append(undos, undo)
+	}
+	if got := doc.String(); got != `{"a": [2, 3], "b": "y", "c d": true}` {
+		t.Fatalf("got %s", got)
+	}
+
+	//追加的数组元素按实际下标撤销
+	if undos[1].Operation != JSON_DIFF_REMOVE || undos[1].Path != "$.a[2]" {
+		t.Fatalf("got undo %d %s", undos[1].Operation, undos[1].Path)
+	}
+	if !undos[2].InArray() || undos[3].InArray() {
+		t.Fatal("InArray check failed")
+	}
+
+	for i := len(undos) - 1; i >= 0; i-- {
+		if _, err := doc.Apply(undos[i]); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if doc.String() != before.String() {
+		t.Fatalf("got %s, expect %s", doc.String(), before.String())
+	}
+
+	if _, err := doc.Apply(&JsonDiff{Operation: JSON_DIFF_REMOVE, Path: "$.x.y"}); nil == err {
+		t.Fatal("missing path should fail")
+	}
+}
@@ -1,8 +1,14 @@
 package mysql
 
 import (
+	crand "crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/binary"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -46,6 +52,61 @@ func CalcPassword(scramble, password []byte) []byte {
 	return scramble
 }
 
+// caching_sha2_password 的快速认证
+// XOR(SHA256(password), SHA256(SHA256(SHA256(password)), scramble))
+func CalcCachingSha2Password(scramble, password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+
+	crypt := sha256.New()
+	crypt.Write(password)
+	message1 := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(message1)
+	message1Hash := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(message1Hash)
+	crypt.Write(scramble)
+	message2 := crypt.Sum(nil)
+
+	for i := range message1 {
+		message1[i] ^= message2[i]
+	}
+	return message1
+}
+
+// 解析服务端返回的PEM格式RSA公钥
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if nil == block {
+		return nil, errors.New("invalid rsa public key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if nil != err {
+		return nil, err
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("invalid rsa public key")
+	}
+	return rsaPub, nil
+}
+
+// 非加密连接下的完整认证, 密码(以0结尾)与scramble异或后用RSA公钥加密
+func EncryptPassword(scramble, password []byte, pub *rsa.PublicKey) ([]byte, error) {
+	plain := make([]byte, len(password)+1)
+	copy(plain, password)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), crand.Reader, pub, plain, nil)
+}
+
 func RandomBuf(size int) ([]byte, error) {
 	buf := make([]byte, size)
 
@@ -270,7 +331,8 @@ func Escape(sql string) string {
 
 	for i, w := 0, 0; i < len(sql); i += w {
 		runeValue, width := utf8.DecodeRuneInString(sql[i:])
-		if c := EncodeMap[byte(runeValue)]; c == DONTESCAPE {
+		//只转义单字节字符, 多字节字符的低位可能与需要转义的字符相同
+		if c := EncodeMap[byte(runeValue)]; width > 1 || c == DONTESCAPE {
 			dest = append(dest, sql[i:i+width]...)
 		} else {
 			dest = append(dest, '\\', c)
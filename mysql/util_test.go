@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+)
+
+func TestCalcCachingSha2Password(t *testing.T) {
+	scramble := []byte("0123456789abcdefghij")
+	got := hex.EncodeToString(CalcCachingSha2Password(scramble, []byte("secret")))
+	expect := "7e4adda2f2d5ef09b4147518becb0cee2939376203650a8c2bb2815959364bd0"
+	if got != expect {
+		t.Fatalf("got %s, expect %s", got, expect)
+	}
+
+	if nil != CalcCachingSha2Password(scramble, nil) {
+		t.Fatal("empty password should be empty auth data")
+	}
+}
+
+func TestEncryptPassword(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pub, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	scramble := []byte("0123456789abcdefghij")
+	enc, err := EncryptPassword(scramble, []byte("secret"), pub)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, enc, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	if !bytes.Equal(plain, []byte("secret\x00")) {
+		t.Fatalf("got %q", plain)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	//丢(U+4E22)的低位与双引号相同, 不应被转义
+	if got := Escape("{\"a\": \"丢'\\n\"}"); got != `{\"a\": \"丢\'\\n\"}` {
+		t.Fatalf("got %s", got)
+	}
+}
@@ -3,11 +3,15 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"time"
 
 	"github.com/SDHM/sqlregret/client"
 	"github.com/SDHM/sqlregret/config"
 	"github.com/SDHM/sqlregret/lifecycle"
+	"github.com/SDHM/sqlregret/mysql"
 	"github.com/cihub/seelog"
 )
 
@@ -16,6 +20,7 @@ type EventParser struct {
 	instCfg        *config.Config
 	reader         client.IBinlogReader
 	tableMetaCache *client.TableMetaCache
+	timePosIndex   *client.TimePosIndex
 	destination    string
 	slaveId        uint32
 	masterPort     uint16
@@ -37,24 +42,44 @@ func (this *EventParser) Start() error {
 
 	this.slaveId = uint32(this.instCfg.SlaveId)
 
-	if this.instCfg.Mode == "online" {
-		this.reader = client.NewNetBinlogReader(
-			this.instCfg.MasterAddress,
-			this.instCfg.DbUsername,
-			this.instCfg.DbPassword,
-			this.instCfg.DefaultDbName,
-			this.masterPort,
-			this.slaveId)
+	if config.G_filterConfig.Mode == "schema" {
+		return this.RunSchemaExport()
+	}
+
+	if this.instCfg.Source != "" {
+		source, err := this.openSource()
+		if nil != err {
+			return err
+		}
+		defer source.Close()
+		this.reader = client.NewStreamBinlogReader(this.instCfg.DefaultDbName, source)
+	} else if this.instCfg.Mode == "online" {
+		netReader, err := this.newNetBinlogReader()
+		if nil != err {
+			return err
+		}
+		netReader.SetHeartbeat(this.instCfg.GetHeartbeatPeriod(), this.instCfg.GetReadTimeout())
+		this.reader = netReader
 	} else if this.instCfg.Mode == "onfile" {
-		this.reader = client.NewFileBinlogReader(
+		fileReader := client.NewFileBinlogReader(
 			this.instCfg.DefaultDbName,
 			this.instCfg.IndexFile,
 			this.instCfg.BasePath)
+		fileReader.SetBinlogFiles(this.instCfg.BinlogFiles)
+		this.reader = fileReader
 	} else {
 		seelog.Errorf("暂时不支持这种类型:%s", this.instCfg.Mode)
 		return errors.New("不支持这种方式")
 	}
 
+	if config.G_filterConfig.Mode == "archive" {
+		return this.RunArchive()
+	}
+
+	if err := this.loadTimePosIndex(); nil != err {
+		return err
+	}
+
 	return this.Run()
 }
 
@@ -68,6 +93,17 @@ func (this *EventParser) Stop() {
 
 func (this *EventParser) Run() error {
 
+	//只指定了开始时间时, 自动定位到包含开始时间的binlog文件
+	if config.G_filterConfig.StartTimeEnable() &&
+		!config.G_filterConfig.StartPosEnable() &&
+		this.instCfg.StartGtid == "" &&
+		this.instCfg.Source == "" {
+		if err := this.locateStartFile(config.G_filterConfig.StartTime); nil != err {
+			return err
+		}
+		this.locateStartPos(config.G_filterConfig.StartTime)
+	}
+
 	if err := this.reader.Connect(); nil != err {
 		return err
 	}
@@ -81,7 +117,21 @@ func (this *EventParser) Run() error {
 	}
 
 	beginTime := time.Now()
-	if err := this.reader.Dump(uint32(this.instCfg.MasterPosition),
+	if this.instCfg.StartGtid != "" {
+		gtidSet, err := mysql.ParseGtidSet(this.instCfg.StartGtid)
+		if nil != err {
+			return err
+		}
+
+		if err := this.reader.DumpGtid(gtidSet); nil != err {
+			return err
+		}
+	} else if fileReader, ok := this.reader.(*client.FileBinlogReader); ok && config.G_filterConfig.Parallel > 1 {
+		if err := fileReader.DumpParallel(uint32(this.instCfg.MasterPosition),
+			this.instCfg.MasterJournalName, config.G_filterConfig.Parallel); nil != err {
+			return err
+		}
+	} else if err := this.reader.Dump(uint32(this.instCfg.MasterPosition),
 		this.instCfg.MasterJournalName); nil != err {
 		return err
 	}
@@ -93,9 +143,174 @@ func (this *EventParser) Run() error {
 	return nil
 }
 
+// 二分查找开始时间所在的binlog文件, 只读取每个文件的第一个事件
+// 即第一个事件时间不晚于开始时间的最后一个文件
+func (this *EventParser) locateStartFile(startTime time.Time) error {
+	files, err := this.reader.ListBinlogFiles(this.instCfg.MasterJournalName)
+	if nil != err {
+		return err
+	}
+
+	if len(files) == 0 {
+		return errors.New("没有找到binlog文件")
+	}
+
+	low, high := 0, len(files)
+	for low < high {
+		mid := (low + high) / 2
+		firstTime, err := this.reader.GetFirstEventTime(files[mid])
+		if nil != err {
+			return err
+		}
+
+		if firstTime.After(startTime) {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+
+	index := low - 1
+	if index < 0 {
+		index = 0
+	}
+
+	seelog.Infof("开始时间%s位于binlog文件:%s", startTime.Format("2006-01-02 15:04:05"), files[index])
+	fmt.Println("自动定位开始文件:", files[index])
+	this.instCfg.MasterJournalName = files[index]
+	this.instCfg.MasterPosition = 4
+	return nil
+}
+
+// 读取时间点索引, mark模式下同时用来保存时间点
+func (this *EventParser) loadTimePosIndex() error {
+	interval := time.Duration(config.G_filterConfig.MarkInterval) * time.Second
+	this.timePosIndex = client.NewTimePosIndex(this.instCfg.GetMarkFile(), interval)
+	if err := this.timePosIndex.Load(); nil != err {
+		return err
+	}
+
+	if config.G_filterConfig.Mode == "mark" {
+		if reader, ok := this.reader.(interface {
+			SetTimePosIndex(*client.TimePosIndex)
+		}); ok {
+			reader.SetTimePosIndex(this.timePosIndex)
+		}
+	}
+	return nil
+}
+
+// 时间点索引中有开始文件内早于开始时间的记录时, 直接从记录的位置开始解析
+func (this *EventParser) locateStartPos(startTime time.Time) {
+	mark := this.timePosIndex.Lookup(startTime)
+	if nil == mark || mark.FileName != this.instCfg.MasterJournalName {
+		return
+	}
+
+	seelog.Infof("按时间点索引定位 时间:%s\t文件名:%s\t位置:%d",
+		mark.Time.Format("2006-01-02 15:04:05"), mark.FileName, mark.Pos)
+	this.instCfg.MasterPosition = int(mark.Pos)
+}
+
+// 把master的binlog原样保存到本地, 从本地已保存的位置继续
+func (this *EventParser) RunArchive() error {
+	netReader, ok := this.reader.(*client.NetBinlogReader)
+	if !ok {
+		return errors.New("archive模式只支持online方式")
+	}
+
+	archiver := client.NewBinlogArchiver(this.instCfg.ArchivePath)
+	netReader.SetArchiver(archiver)
+	fileName, pos, err := archiver.ResumePosition(this.instCfg.MasterJournalName)
+	if nil != err {
+		return err
+	}
+
+	if err := this.reader.Connect(); nil != err {
+		return err
+	}
+
+	if err := this.reader.Register(); nil != err {
+		return err
+	}
+
+	seelog.Infof("开始保存binlog 文件:%s\t位置:%d", fileName, pos)
+	err = this.reader.Dump(uint32(pos), fileName)
+	archiver.Close()
+	return err
+}
+
+// 导出表结构快照, 用于离线解析
+func (this *EventParser) RunSchemaExport() error {
+	metaConnector, err := this.newNetBinlogReader()
+	if nil != err {
+		return err
+	}
+
+	if err := metaConnector.Connect(); nil != err {
+		return err
+	}
+	defer metaConnector.Close()
+
+	tableMetaCache := client.NewTableMetaCache(metaConnector)
+	if err := tableMetaCache.ExportSnapshot(config.G_filterConfig.FilterDb, config.G_filterConfig.FilterTable); nil != err {
+		seelog.Error("导出表结构失败:", err.Error())
+		return err
+	}
+
+	if err := tableMetaCache.SaveSnapshot(config.G_filterConfig.SchemaFile); nil != err {
+		seelog.Error("保存表结构快照失败:", err.Error())
+		return err
+	}
+
+	fmt.Println("表结构快照已保存:", config.G_filterConfig.SchemaFile)
+	return nil
+}
+
 func (this *EventParser) PreDump() error {
 
-	metaConnector := client.NewNetBinlogReader(
+	//有表结构快照时不连接数据库
+	if config.G_filterConfig.SchemaFile != "" {
+		tableMetaCache, err := client.NewSnapshotTableMetaCache(config.G_filterConfig.SchemaFile)
+		if nil != err {
+			seelog.Error("读取表结构快照失败:", err.Error())
+			return err
+		}
+		this.tableMetaCache = tableMetaCache
+		this.reader.SetTableMetaCache(this.tableMetaCache)
+		return nil
+	}
+
+	metaConnector, err := this.newNetBinlogReader()
+	if nil != err {
+		return err
+	}
+
+	if err := metaConnector.Connect(); nil != err {
+		//解析文件时表结构可以从TABLE_MAP_EVENT的元数据中获取(binlog_row_metadata=FULL), 不需要连接数据库
+		if this.instCfg.Mode == "onfile" || this.instCfg.Source != "" {
+			seelog.Warn("连接数据库失败, 只能使用binlog中记录的表结构:", err.Error())
+			return nil
+		}
+		return err
+	}
+
+	this.tableMetaCache = client.NewTableMetaCache(metaConnector)
+	this.reader.SetTableMetaCache(this.tableMetaCache)
+	return nil
+}
+
+// binlog数据流, -表示标准输入
+func (this *EventParser) openSource() (io.ReadCloser, error) {
+	if this.instCfg.Source == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(this.instCfg.Source)
+}
+
+// dump连接与元数据连接使用相同的连接配置
+func (this *EventParser) newNetBinlogReader() (*client.NetBinlogReader, error) {
+	reader := client.NewNetBinlogReader(
 		this.instCfg.MasterAddress,
 		this.instCfg.DbUsername,
 		this.instCfg.DbPassword,
@@ -103,13 +318,20 @@ func (this *EventParser) PreDump() error {
 		this.masterPort,
 		this.slaveId)
 
-	if err := metaConnector.Connect(); nil != err {
-		return err
+	tlsMode, err := this.instCfg.GetTlsMode()
+	if nil != err {
+		return nil, err
 	}
 
-	this.tableMetaCache = client.NewTableMetaCache(metaConnector)
-	this.reader.SetTableMetaCache(this.tableMetaCache)
-	return nil
+	if tlsMode != config.TLS_MODE_DISABLED {
+		tlsConfig, err := this.instCfg.GetTlsConfig()
+		if nil != err {
+			return nil, err
+		}
+		reader.SetTLS(tlsMode, tlsConfig)
+	}
+
+	return reader, nil
 }
 
 func (this *EventParser) AfterDump() {
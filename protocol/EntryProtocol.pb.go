@@ -733,6 +733,13 @@ func (m *RowChange) GetDdlSchemaName() string {
 	return ""
 }
 
+func (m *RowChange) SetDdlSchemaName(ddlSchemaName string) {
+	if nil == m.DdlSchemaName {
+		m.DdlSchemaName = new(string)
+	}
+	*m.DdlSchemaName = ddlSchemaName
+}
+
 // *开始事务的一些信息*
 type TransactionBegin struct {
 	// *已废弃，请使用header里的executeTime*